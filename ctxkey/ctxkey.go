@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// 各模块共享的gin.Context key，不依赖其他模块
+package ctxkey
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 请求ID
+	RequestId = "_REQEUST_ID"
+	// handler名称，由handler设置时覆盖gin.Context.HandlerName
+	Handler = "_NEVE_LOG_HANDLER"
+	// 路由所属的Component名称
+	Component = "_NEVE_LOG_COMPONENT"
+	// Processor的日志对象（xlog.Logger）
+	Logger = "_NEVE_LOGGER"
+)
+
+// 获得当前请求的ID，不存在时返回空字符串
+func GetRequestId(c *gin.Context) string {
+	return c.GetString(RequestId)
+}
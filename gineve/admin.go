@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gineve
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"strings"
+)
+
+const (
+	AdminTokenHeader = "X-Admin-Token"
+)
+
+// 校验管理接口的token：请求需要携带Authorization: Bearer <token>或者X-Admin-Token: <token>，否则返回401
+func AdminTokenAuth(token string) gin.HandlerFunc {
+	expect := []byte(token)
+	return func(ctx *gin.Context) {
+		v := ctx.GetHeader(AdminTokenHeader)
+		if v == "" {
+			auth := ctx.GetHeader("Authorization")
+			if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+				v = auth[7:]
+			}
+		}
+		if v == "" || subtle.ConstantTimeCompare([]byte(v), expect) != 1 {
+			result.UnauthorizedError.Clone().WriteJson(ctx)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,463 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gineve
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"io"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BindTagPath   = "path"
+	BindTagQuery  = "query"
+	BindTagHeader = "header"
+	BindTagCookie = "cookie"
+	BindTagForm   = "form"
+
+	// 默认值，如`default:"10"`
+	BindTagDefault = "default"
+	// slice分隔符，如`sep:","`，则"a,b"会被拆分为两个元素
+	BindTagSeparator = "sep"
+	// 时间格式，与gin保持一致：time_format、time_utc、time_location
+	BindTagTimeFormat   = "time_format"
+	BindTagTimeUTC      = "time_utc"
+	BindTagTimeLocation = "time_location"
+
+	defaultMultipartMemory = 32 << 20
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	bindSourceTags = []string{BindTagPath, BindTagQuery, BindTagHeader, BindTagCookie}
+)
+
+// 使用一个结构体同时绑定path、query、header、cookie以及body的数据，绑定完成后统一校验。
+// 字段通过tag声明数据来源，如：
+//
+//	type GetUserReq struct {
+//	    Id     int64     `path:"id"`
+//	    Q      string    `query:"q" default:"all"`
+//	    Tenant string    `header:"X-Tenant"`
+//	    Sid    string    `cookie:"sid"`
+//	    Since  time.Time `query:"since" time_format:"2006-01-02"`
+//	    Tags   []string  `query:"tag" sep:","`
+//	    Name   string    `json:"name"`
+//	}
+//
+// 同一字段声明多个来源时，按path、query、header、cookie的顺序取第一个存在的值。
+// body根据Content-Type解析（json、xml、form、multipart，其他类型忽略），body的绑定先于其他来源，
+// 因此path、query等来源的值会覆盖body中的同名字段。
+func Bind(ctx *gin.Context, obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("gineve: Bind target must be a non-nil pointer")
+	}
+	if v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("gineve: Bind target must be a pointer to struct, got %T", obj)
+	}
+
+	err := bindBody(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	b := binder{ctx: ctx}
+	err = b.bindStruct(v.Elem())
+	if err != nil {
+		return err
+	}
+
+	if binding.Validator == nil {
+		return nil
+	}
+	// 使RequestBodyLogWriter可以获得请求
+	if w, ok := binding.Validator.(*loghttp.RequestBodyLogWriter); ok {
+		return w.ValidateContext(ctx, obj)
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+func bindBody(ctx *gin.Context, obj interface{}) error {
+	req := ctx.Request
+	if req.Body == nil || req.ContentLength == 0 {
+		return nil
+	}
+	switch ctx.ContentType() {
+	case binding.MIMEXML, binding.MIMEXML2:
+		err := xml.NewDecoder(req.Body).Decode(obj)
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case binding.MIMEPOSTForm:
+		if err := req.ParseForm(); err != nil {
+			return err
+		}
+		b := binder{ctx: ctx}
+		return b.bindForm(reflect.ValueOf(obj).Elem(), req.PostForm)
+	case binding.MIMEMultipartPOSTForm:
+		if err := req.ParseMultipartForm(defaultMultipartMemory); err != nil {
+			return err
+		}
+		b := binder{ctx: ctx}
+		return b.bindForm(reflect.ValueOf(obj).Elem(), req.PostForm)
+	case binding.MIMEJSON, "":
+		decoder := json.NewDecoder(req.Body)
+		if binding.EnableDecoderUseNumber {
+			decoder.UseNumber()
+		}
+		if binding.EnableDecoderDisallowUnknownFields {
+			decoder.DisallowUnknownFields()
+		}
+		err := decoder.Decode(obj)
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+type binder struct {
+	ctx   *gin.Context
+	query url.Values
+}
+
+func (b *binder) bindStruct(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+
+		vals, source, name, found := b.lookup(field)
+		if source == "" {
+			if isNestedStruct(field.Type) {
+				if err := b.bindNested(fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !found {
+			def, ok := field.Tag.Lookup(BindTagDefault)
+			if !ok || !fv.IsZero() {
+				continue
+			}
+			vals = []string{def}
+		}
+		if err := setField(fv, field, vals); err != nil {
+			return fmt.Errorf("gineve: bind %s %q failed: %v", source, name, err)
+		}
+	}
+	return nil
+}
+
+func (b *binder) bindNested(fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			if !fv.CanSet() {
+				return nil
+			}
+			nv := reflect.New(fv.Type().Elem())
+			if err := b.bindStruct(nv.Elem()); err != nil {
+				return err
+			}
+			if !nv.Elem().IsZero() {
+				fv.Set(nv)
+			}
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	return b.bindStruct(fv)
+}
+
+func (b *binder) bindForm(v reflect.Value, form url.Values) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+		name := tagName(field.Tag.Get(BindTagForm))
+		if name == "" || name == "-" {
+			if isNestedStruct(field.Type) {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						if !fv.CanSet() {
+							continue
+						}
+						fv.Set(reflect.New(fv.Type().Elem()))
+					}
+					fv = fv.Elem()
+				}
+				if err := b.bindForm(fv, form); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		vals, ok := form[name]
+		if !ok {
+			continue
+		}
+		if err := setField(fv, field, vals); err != nil {
+			return fmt.Errorf("gineve: bind %s %q failed: %v", BindTagForm, name, err)
+		}
+	}
+	return nil
+}
+
+// 返回字段对应的值、来源、名称以及是否找到；source为空表示该字段未声明任何来源
+func (b *binder) lookup(field reflect.StructField) ([]string, string, string, bool) {
+	source, name := "", ""
+	for _, tag := range bindSourceTags {
+		n := tagName(field.Tag.Get(tag))
+		if n == "" || n == "-" {
+			continue
+		}
+		if source == "" {
+			source, name = tag, n
+		}
+		if vals, ok := b.values(tag, n); ok {
+			return vals, tag, n, true
+		}
+	}
+	return nil, source, name, false
+}
+
+func (b *binder) values(source, name string) ([]string, bool) {
+	req := b.ctx.Request
+	switch source {
+	case BindTagPath:
+		if v, ok := b.ctx.Params.Get(name); ok {
+			return []string{v}, true
+		}
+	case BindTagQuery:
+		if b.query == nil {
+			b.query = req.URL.Query()
+		}
+		if vs, ok := b.query[name]; ok {
+			return vs, true
+		}
+	case BindTagHeader:
+		if vs, ok := req.Header[textproto.CanonicalMIMEHeaderKey(name)]; ok {
+			return vs, true
+		}
+	case BindTagCookie:
+		if c, err := req.Cookie(name); err == nil {
+			return []string{c.Value}, true
+		}
+	}
+	return nil, false
+}
+
+func setField(fv reflect.Value, field reflect.StructField, vals []string) error {
+	if sep := field.Tag.Get(BindTagSeparator); sep != "" {
+		var split []string
+		for _, v := range vals {
+			split = append(split, strings.Split(v, sep)...)
+		}
+		vals = split
+	}
+
+	if len(vals) == 0 {
+		return nil
+	}
+	if reflect.PtrTo(fv.Type()).Implements(textUnmarshalType) {
+		return setValue(fv, field, vals[0])
+	}
+
+	switch fv.Kind() {
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(vals[0]))
+			return nil
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i := range vals {
+			if err := setValue(slice.Index(i), field, vals[i]); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(vals) != fv.Len() {
+			return fmt.Errorf("expect %d values but got %d", fv.Len(), len(vals))
+		}
+		for i := range vals {
+			if err := setValue(fv.Index(i), field, vals[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setValue(fv, field, vals[0])
+}
+
+func setValue(v reflect.Value, field reflect.StructField, val string) error {
+	if v.Kind() == reflect.Ptr {
+		nv := reflect.New(v.Type().Elem())
+		if err := setValue(nv.Elem(), field, val); err != nil {
+			return err
+		}
+		v.Set(nv)
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		return setTime(v, field, val)
+	case durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		if val == "" {
+			val = "false"
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if val == "" {
+			val = "0"
+		}
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if val == "" {
+			val = "0"
+		}
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if val == "" {
+			val = "0"
+		}
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(val))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func setTime(v reflect.Value, field reflect.StructField, val string) error {
+	format := field.Tag.Get(BindTagTimeFormat)
+	if format == "" {
+		format = time.RFC3339
+	}
+
+	switch tf := strings.ToLower(format); tf {
+	case "unix", "unixnano":
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		if tf == "unix" {
+			v.Set(reflect.ValueOf(time.Unix(i, 0)))
+		} else {
+			v.Set(reflect.ValueOf(time.Unix(0, i)))
+		}
+		return nil
+	}
+
+	if val == "" {
+		v.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+
+	loc := time.Local
+	if utc, _ := strconv.ParseBool(field.Tag.Get(BindTagTimeUTC)); utc {
+		loc = time.UTC
+	}
+	if l := field.Tag.Get(BindTagTimeLocation); l != "" {
+		tl, err := time.LoadLocation(l)
+		if err != nil {
+			return err
+		}
+		loc = tl
+	}
+	t, err := time.ParseInLocation(format, val, loc)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func tagName(tag string) string {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType &&
+		!reflect.PtrTo(t).Implements(textUnmarshalType)
+}
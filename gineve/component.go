@@ -22,6 +22,31 @@ type Component interface {
 	HttpRoutes(engine gin.IRouter)
 }
 
+// Controller通过方法名与路由的映射表声明路由，Processor自动将对应的方法绑定到路由上，如：
+//
+//	func (c *userController) RouteTable() map[string]string {
+//		return map[string]string{
+//			"GetUser": "GET /users/:id",
+//		}
+//	}
+//
+// 方法签名参考Handle
+type Controller interface {
+	RouteTable() map[string]string
+}
+
+// Route用于在bean的字段tag中声明路由，handler为绑定的方法名，如：
+//
+//	type userController struct {
+//		getUser gineve.Route `route:"GET /users/:id" handler:"GetUser"`
+//	}
+type Route struct{}
+
+// 管理接口，在neve.web.admin配置的路径（以及端口）下注册路由
+type AdminComponent interface {
+	AdminRoutes(r gin.IRouter)
+}
+
 type Filter interface {
 	FilterHandler(ctx *gin.Context)
 }
@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gineve
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/ctxkey"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	RouteTag   = "route"
+	HandlerTag = "handler"
+
+	MethodAny = "ANY"
+)
+
+var routeType = reflect.TypeOf(Route{})
+
+type routeEntry struct {
+	method  string
+	path    string
+	handler gin.HandlerFunc
+}
+
+type controllerComponent struct {
+	name   string
+	routes []routeEntry
+}
+
+func (c *controllerComponent) componentName() string {
+	return c.name
+}
+
+func (c *controllerComponent) HttpRoutes(engine gin.IRouter) {
+	for _, r := range c.routes {
+		if r.method == MethodAny {
+			engine.Any(r.path, r.handler)
+		} else {
+			engine.Handle(r.method, r.path, r.handler)
+		}
+	}
+}
+
+// 解析bean的路由声明（RouteTable以及Route字段tag），并将对应的方法适配为Component
+func newControllerComponent(o interface{}) (*controllerComponent, error) {
+	table := map[string]string{}
+	if c, ok := o.(Controller); ok {
+		for k, v := range c.RouteTable() {
+			table[v] = k
+		}
+	}
+	for route, name := range routeTags(o) {
+		table[route] = name
+	}
+
+	ret := &controllerComponent{name: fmt.Sprintf("%T", o)}
+	bv := reflect.ValueOf(o)
+	for route, name := range table {
+		method, path, err := parseRoute(route)
+		if err != nil {
+			return nil, err
+		}
+		mv := bv.MethodByName(name)
+		if !mv.IsValid() {
+			return nil, fmt.Errorf("gineve: method %s of %T not found, route: %s", name, o, route)
+		}
+		h, err := newHandler(mv)
+		if err != nil {
+			return nil, fmt.Errorf("gineve: route %s of %T: %v", route, o, err)
+		}
+		ret.routes = append(ret.routes, routeEntry{
+			method:  method,
+			path:    path,
+			handler: namedHandler(ret.name+"."+name, h),
+		})
+	}
+	sort.Slice(ret.routes, func(i, j int) bool {
+		if ret.routes[i].path == ret.routes[j].path {
+			return ret.routes[i].method < ret.routes[j].method
+		}
+		return ret.routes[i].path < ret.routes[j].path
+	})
+	return ret, nil
+}
+
+// 将Controller或者通过Route tag声明路由的对象转换为Component，路由与Processor注册的一致
+func NewControllerComponent(o interface{}) (Component, error) {
+	comp, err := newControllerComponent(o)
+	if err != nil {
+		return nil, err
+	}
+	return comp, nil
+}
+
+// 反射适配的handler无法通过gin.Context.HandlerName获得有意义的名称，在context中设置绑定的方法名
+func namedHandler(name string, h gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(ctxkey.Handler, name)
+		h(ctx)
+	}
+}
+
+// 返回route -> 方法名
+func routeTags(o interface{}) map[string]string {
+	t := reflect.TypeOf(o)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var ret map[string]string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type != routeType {
+			continue
+		}
+		route, name := field.Tag.Get(RouteTag), field.Tag.Get(HandlerTag)
+		if route == "" || name == "" {
+			continue
+		}
+		if ret == nil {
+			ret = map[string]string{}
+		}
+		ret[route] = name
+	}
+	return ret
+}
+
+func hasRouteTags(o interface{}) bool {
+	return len(routeTags(o)) > 0
+}
+
+// 解析"GET /users/:id"格式的路由
+func parseRoute(route string) (string, string, error) {
+	fields := strings.Fields(route)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("gineve: route %q is invalid, expect format: \"METHOD /path\"", route)
+	}
+	return strings.ToUpper(fields[0]), fields[1], nil
+}
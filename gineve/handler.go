@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gineve
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/ctxkey"
+	"github.com/xfali/neve-web/result"
+	"github.com/xfali/xlog"
+	"reflect"
+)
+
+var (
+	ginContextType = reflect.TypeOf((*gin.Context)(nil))
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// 将函数适配为gin.HandlerFunc，支持的函数签名：
+//
+//	func(ctx *gin.Context)
+//	func([ctx *gin.Context], [req *T]) ([R], [error])
+//
+// req通过Bind绑定，绑定失败输出result.BadRequestError；
+// 返回值的处理参考WriteResult。
+// 函数签名不支持时panic。
+func Handle(fn interface{}) gin.HandlerFunc {
+	h, err := newHandler(reflect.ValueOf(fn))
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// 输出处理结果：
+// err不为nil时，如果err为*result.Result则直接输出，否则记录日志并输出result.InternalError（不包含err的内容）；
+// data为result.Result或*result.Result时直接输出，否则输出result.Ok(data)。
+// 如果handler已经输出了响应则不再处理。
+func WriteResult(ctx *gin.Context, data interface{}, err error) {
+	if ctx.Writer.Written() {
+		return
+	}
+	if err != nil {
+		var r *result.Result
+		if errors.As(err, &r) {
+			r.WriteJson(ctx)
+			return
+		}
+		// 错误可能包含内部信息，仅记录日志，不输出给客户端
+		loggerOf(ctx).Errorf("[Handler %s] %s %s error: %v\n", ctxkey.GetRequestId(ctx), ctx.Request.Method, ctx.Request.URL.Path, err)
+		_ = ctx.Error(err)
+		ctx.Abort()
+		result.InternalError.Clone().WriteJson(ctx)
+		return
+	}
+	switch v := data.(type) {
+	case result.Result:
+		v.WriteJson(ctx)
+	case *result.Result:
+		if v == nil {
+			result.OK.Clone().WriteJson(ctx)
+		} else {
+			v.WriteJson(ctx)
+		}
+	default:
+		ret := result.Ok(data)
+		ret.WriteJson(ctx)
+	}
+}
+
+// 获得Processor设置的logger（参考OptSetLogger），未设置时使用xlog.GetLogger()
+func loggerOf(ctx *gin.Context) xlog.Logger {
+	if v, ok := ctx.Get(ctxkey.Logger); ok {
+		if logger, ok := v.(xlog.Logger); ok {
+			return logger
+		}
+	}
+	return xlog.GetLogger()
+}
+
+func newHandler(fv reflect.Value) (gin.HandlerFunc, error) {
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("gineve: handler must be a function, but got %s", fv.Kind())
+	}
+	if f, ok := fv.Interface().(func(*gin.Context)); ok {
+		return f, nil
+	}
+
+	ft := fv.Type()
+	withCtx := false
+	var reqType reflect.Type
+	for i := 0; i < ft.NumIn(); i++ {
+		in := ft.In(i)
+		switch {
+		case i == 0 && in == ginContextType:
+			withCtx = true
+		case reqType == nil && in != ginContextType && isBindable(in):
+			reqType = in
+		default:
+			return nil, fmt.Errorf("gineve: unsupported parameter %s of handler %s", in, ft)
+		}
+	}
+
+	dataIdx, errIdx := -1, -1
+	switch ft.NumOut() {
+	case 0:
+	case 1:
+		if ft.Out(0) == errorType {
+			errIdx = 0
+		} else {
+			dataIdx = 0
+		}
+	case 2:
+		if ft.Out(1) != errorType {
+			return nil, fmt.Errorf("gineve: the last return value of handler %s must be error", ft)
+		}
+		dataIdx, errIdx = 0, 1
+	default:
+		return nil, fmt.Errorf("gineve: too many return values of handler %s", ft)
+	}
+
+	return func(ctx *gin.Context) {
+		args := make([]reflect.Value, 0, ft.NumIn())
+		if withCtx {
+			args = append(args, reflect.ValueOf(ctx))
+		}
+		if reqType != nil {
+			req, err := bindRequest(ctx, reqType)
+			if err != nil {
+				writeBadRequest(ctx, err)
+				return
+			}
+			args = append(args, req)
+		}
+
+		rets := fv.Call(args)
+		if ft.NumOut() == 0 {
+			return
+		}
+		var data interface{}
+		var err error
+		if dataIdx >= 0 {
+			data = rets[dataIdx].Interface()
+		}
+		if errIdx >= 0 {
+			if e := rets[errIdx].Interface(); e != nil {
+				err = e.(error)
+			}
+		}
+		WriteResult(ctx, data, err)
+	}, nil
+}
+
+func bindRequest(ctx *gin.Context, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		return v, Bind(ctx, v.Interface())
+	}
+	v := reflect.New(t)
+	return v.Elem(), Bind(ctx, v.Interface())
+}
+
+func isBindable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
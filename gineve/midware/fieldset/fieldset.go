@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fieldset
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"strings"
+)
+
+const (
+	FieldsParam = "fields"
+)
+
+// 解析?fields=id,name,owner.email，result.Result输出时将Data裁剪为仅包含这些字段。
+// allow为允许请求的字段路径，为空则不限制；允许"owner"时其下的"owner.email"也被允许。
+// 请求了不被允许的字段时返回result.BadRequestError。
+func Fields(allow ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v := ctx.Query(FieldsParam)
+		if v == "" {
+			ctx.Next()
+			return
+		}
+		fields := result.ParseFields(v)
+		for _, f := range fields {
+			if !allowed(allow, f) {
+				ret := result.BadRequestError.Clone().SetMessage(fmt.Sprintf("field %q is not allowed", f))
+				ret.WriteJson(ctx)
+				ctx.Abort()
+				return
+			}
+		}
+		result.SetFields(ctx, fields)
+		ctx.Next()
+	}
+}
+
+func allowed(allow []string, field string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	for _, a := range allow {
+		if field == a || strings.HasPrefix(field, a+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonpolicy
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"strings"
+)
+
+// 将gin输出的json（如ctx.JSON）按编码策略重新编码。
+// result.Result.WriteJson已经按策略编码，不会重复处理。
+func Reencode(enc result.JsonReencoder) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		w := &reencodeWriter{
+			ResponseWriter: ctx.Writer,
+			ctx:            ctx,
+			enc:            enc,
+		}
+		ctx.Writer = w
+		ctx.Next()
+		w.flush()
+	}
+}
+
+type reencodeWriter struct {
+	gin.ResponseWriter
+	ctx *gin.Context
+	enc result.JsonReencoder
+
+	decided   bool
+	buffering bool
+	buf       *bytes.Buffer
+}
+
+func (w *reencodeWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if w.ctx.GetBool(result.JsonEncodedKey) {
+		return
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), gin.MIMEJSON) {
+		w.buffering = true
+		w.buf = bytes.NewBuffer(nil)
+	}
+}
+
+func (w *reencodeWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *reencodeWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.buf.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *reencodeWriter) Written() bool {
+	if w.buffering && w.buf.Len() > 0 {
+		return true
+	}
+	return w.ResponseWriter.Written()
+}
+
+func (w *reencodeWriter) Flush() {
+	w.flush()
+	w.ResponseWriter.Flush()
+}
+
+func (w *reencodeWriter) flush() {
+	if !w.buffering {
+		return
+	}
+	w.buffering = false
+	if w.buf.Len() == 0 {
+		return
+	}
+	data := w.buf.Bytes()
+	if b, err := w.enc.Reencode(data); err == nil {
+		data = b
+	} else {
+		_ = w.ctx.Error(err)
+	}
+	w.Header().Del("Content-Length")
+	_, _ = w.ResponseWriter.Write(data)
+	w.buf = nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xfali/fig"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	LogAsyncKey     = "neve.web.log.async"
+	LogAsyncSinkKey = "neve.web.log.asyncSink"
+
+	// 队列满时丢弃新的记录
+	OverflowDropNewest = "dropNewest"
+	// 队列满时丢弃最旧的记录
+	OverflowDropOldest = "dropOldest"
+	// 队列满时阻塞请求直到有空间
+	OverflowBlock = "block"
+
+	DefaultAsyncQueueSize = 1024
+	DefaultAsyncWorkers   = 1
+)
+
+type asyncConf struct {
+	Enable bool
+	// 队列大小，默认1024
+	QueueSize int
+	// 格式化以及输出日志的协程数，默认1
+	Workers int
+	// 队列满时的策略：dropNewest（默认）、dropOldest、block，也可以使用drop-newest、drop-oldest
+	Overflow string
+}
+
+// 返回规范的overflow策略名称，不区分大小写，支持连字符形式（如drop-oldest），为空时返回dropNewest
+func ParseOverflow(overflow string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(overflow, "-", "")) {
+	case "", strings.ToLower(OverflowDropNewest):
+		return OverflowDropNewest, nil
+	case strings.ToLower(OverflowDropOldest):
+		return OverflowDropOldest, nil
+	case OverflowBlock:
+		return OverflowBlock, nil
+	}
+	return "", fmt.Errorf("loghttp: unknown async overflow %q, expect one of %s, %s, %s",
+		overflow, OverflowDropNewest, OverflowDropOldest, OverflowBlock)
+}
+
+// 读取并校验neve.web.log.async配置，Overflow转换为规范的名称
+func asyncSinkConfig(conf fig.Properties) (asyncConf, error) {
+	ac := asyncConf{}
+	if err := conf.GetValue(LogAsyncKey, &ac); err != nil {
+		return ac, err
+	}
+	overflow, err := ParseOverflow(ac.Overflow)
+	if err != nil {
+		return ac, err
+	}
+	ac.Overflow = overflow
+	return ac, nil
+}
+
+// 根据neve.web.log.async配置创建AsyncSink，未开启时返回nil
+func asyncSinkFromConfig(conf fig.Properties) (*AsyncSink, error) {
+	ac, err := asyncSinkConfig(conf)
+	if err != nil || !ac.Enable {
+		return nil, err
+	}
+	return NewAsyncSink(ac.QueueSize, ac.Workers, ac.Overflow)
+}
+
+type asyncTask func(buf *bytes.Buffer)
+
+type AsyncStats struct {
+	// 已输出的记录数
+	Written uint64
+	// 因队列满丢弃的记录数
+	Dropped uint64
+	// 队列中等待输出的记录数
+	Pending int
+}
+
+// 异步输出日志：记录进入有界队列，由工作协程格式化并输出。
+// Close后不再接收新的记录（之后的记录同步输出），并等待队列中的记录输出完成。
+type AsyncSink struct {
+	// 64位原子操作的字段放在开头，保证在32位平台上8字节对齐
+	written uint64
+	dropped uint64
+
+	queue    chan asyncTask
+	overflow string
+
+	lock   sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// overflow为OverflowDropNewest、OverflowDropOldest或OverflowBlock，参考ParseOverflow，策略错误时返回错误
+func NewAsyncSink(queueSize, workers int, overflow string) (*AsyncSink, error) {
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncQueueSize
+	}
+	if workers <= 0 {
+		workers = DefaultAsyncWorkers
+	}
+	overflow, err := ParseOverflow(overflow)
+	if err != nil {
+		return nil, err
+	}
+	ret := &AsyncSink{
+		queue:    make(chan asyncTask, queueSize),
+		overflow: overflow,
+	}
+	ret.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go ret.run()
+	}
+	return ret, nil
+}
+
+func (s *AsyncSink) run() {
+	defer s.wg.Done()
+	buf := bytes.NewBuffer(nil)
+	for t := range s.queue {
+		buf.Reset()
+		t(buf)
+		atomic.AddUint64(&s.written, 1)
+	}
+}
+
+func (s *AsyncSink) submit(t asyncTask) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		t(bytes.NewBuffer(nil))
+		atomic.AddUint64(&s.written, 1)
+		return
+	}
+	switch s.overflow {
+	case OverflowBlock:
+		s.queue <- t
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- t:
+				return
+			default:
+			}
+			select {
+			case <-s.queue:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- t:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+func (s *AsyncSink) Stats() AsyncStats {
+	return AsyncStats{
+		Written: atomic.LoadUint64(&s.written),
+		Dropped: atomic.LoadUint64(&s.dropped),
+		Pending: len(s.queue),
+	}
+}
+
+// 停止接收新的记录并等待队列中的记录输出完成
+func (s *AsyncSink) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.lock.Unlock()
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-web/gineve/midware/requestid"
+	"github.com/xfali/neve-web/mask"
+	"github.com/xfali/xlog"
+	"reflect"
+	"strings"
+)
+
+const (
+	LogBindBodyKey = "neve.web.log.bindBody"
+)
+
+type bindConf struct {
+	Enable bool
+	// 开启的路由，格式参考RouteMatcher，为空时所有路由均开启
+	Routes []string
+	// 日志级别，为空时使用neve.web.log.level
+	Level string
+}
+
+// 包装binding.StructValidator，在校验前输出绑定后的请求对象，
+// 输出前按mask tag脱敏，并使用Redactor按字段名称脱敏。
+// gin的StructValidator无法获得请求：gineve.Bind通过ValidateContext传入请求，日志中包含请求ID、path以及method；
+// 通过gin.Context.ShouldBind等方式绑定的对象只能通过ValidateStruct输出，不包含请求信息，配置Routes时不输出。
+type RequestBodyLogWriter struct {
+	Logger xlog.Logger
+	V      binding.StructValidator
+	// 为nil时仅按mask tag脱敏
+	Redactor *Redactor
+	// 开启的路由，为空时所有路由均开启。仅对传入了请求的校验生效（参考ValidateContext），
+	// 配置后无法获得请求的绑定对象（如通过gin.Context.ShouldBind绑定）不输出
+	Routes []*RouteMatcher
+	// 日志级别：debug、info（默认）、warn、error
+	Level string
+}
+
+// 创建RequestBodyLogWriter，v为被包装的StructValidator（通常为binding.Validator）
+func NewRequestBodyLogWriter(logger xlog.Logger, v binding.StructValidator, redactor *Redactor, routes ...string) (*RequestBodyLogWriter, error) {
+	// 避免重复包装
+	if w, ok := v.(*RequestBodyLogWriter); ok {
+		v = w.V
+	}
+	matchers, err := newRouteMatchers(routes)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestBodyLogWriter{
+		Logger:   logger,
+		V:        v,
+		Redactor: redactor,
+		Routes:   matchers,
+	}, nil
+}
+
+// 按neve.web.log.bindBody配置创建RequestBodyLogWriter，未开启时返回nil
+func NewRequestBodyLogWriterFromConfig(conf fig.Properties, logger xlog.Logger, v binding.StructValidator, redactor *Redactor) (*RequestBodyLogWriter, error) {
+	bc := bindConf{}
+	if err := conf.GetValue(LogBindBodyKey, &bc); err != nil {
+		return nil, err
+	}
+	if !bc.Enable {
+		return nil, nil
+	}
+	ret, err := NewRequestBodyLogWriter(logger, v, redactor, bc.Routes...)
+	if err != nil {
+		return nil, err
+	}
+	ret.Level, err = BindLogLevelFromConfig(conf)
+	return ret, err
+}
+
+// 获得绑定对象日志的级别：neve.web.log.bindBody.level，未配置时使用neve.web.log.level
+func BindLogLevelFromConfig(conf fig.Properties) (string, error) {
+	bc := bindConf{}
+	if err := conf.GetValue(LogBindBodyKey, &bc); err != nil {
+		return "", err
+	}
+	if bc.Level != "" {
+		return bc.Level, nil
+	}
+	level := ""
+	err := conf.GetValue(LogLevelKey, &level)
+	return level, err
+}
+
+func (v *RequestBodyLogWriter) ValidateStruct(obj interface{}) error {
+	return v.ValidateContext(nil, obj)
+}
+
+// 输出绑定对象并校验，c为对象所属的请求，用于按路由过滤以及输出请求信息，可以为nil
+func (v *RequestBodyLogWriter) ValidateContext(c *gin.Context, obj interface{}) error {
+	v.log(c, obj)
+	if v.V == nil {
+		return nil
+	}
+	return v.V.ValidateStruct(obj)
+}
+
+func (v *RequestBodyLogWriter) log(c *gin.Context, obj interface{}) {
+	valueType := reflect.TypeOf(obj)
+	if valueType == nil {
+		return
+	}
+	if valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if valueType.Kind() != reflect.Struct {
+		return
+	}
+
+	if len(v.Routes) > 0 && (c == nil || !matchAny(v.Routes, c)) {
+		return
+	}
+
+	b, err := json.Marshal(mask.Mask(obj))
+	if err != nil {
+		v.Logger.Errorf("Request Log bind body error: %s\n", err.Error())
+		return
+	}
+	b = v.Redactor.RedactBody(gin.MIMEJSON, b)
+	if c == nil {
+		v.output("Request Log bind body is %s\n", string(b))
+		return
+	}
+	v.output("[Request  %s] [path]: %s , [method]: %s , [bind]: %s %s\n",
+		requestid.Get(c), c.Request.URL.Path, c.Request.Method, valueType.Name(), string(b))
+}
+
+func (v *RequestBodyLogWriter) output(format string, args ...interface{}) {
+	switch strings.ToLower(v.Level) {
+	case LogLevelDebug:
+		v.Logger.Debugf(format, args...)
+	case LogLevelWarn:
+		v.Logger.Warnf(format, args...)
+	case LogLevelError:
+		v.Logger.Errorf(format, args...)
+	default:
+		v.Logger.Infof(format, args...)
+	}
+}
+
+func (v *RequestBodyLogWriter) Engine() interface{} {
+	if v.V == nil {
+		return nil
+	}
+	return v.V.Engine()
+}
+
+// 获得HttpLogger使用的Redactor，无法获得时返回nil
+func GetRedactor(logger HttpLogger) *Redactor {
+	if v, ok := logger.(interface{ Redactor() *Redactor }); ok {
+		return v.Redactor()
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	LogBodyKey       = "neve.web.log.body"
+	LogBodyPolicyKey = "neve.web.log.bodyPolicy"
+)
+
+// 默认输出body的content type
+var DefaultBodyAllow = []string{
+	"application/json",
+	"application/*+json",
+	"application/xml",
+	"application/*+xml",
+	"application/x-www-form-urlencoded",
+	"application/javascript",
+	"text/*",
+}
+
+type bodyConf struct {
+	// 输出body的content type，支持通配符，如text/*、application/*+json
+	Allow []string
+	// 仅输出摘要的content type，优先于Allow
+	Deny []string
+}
+
+// 根据content type决定输出body还是输出摘要（如"multipart: 3 parts, file foo.png 120KB"）。
+// 不在Allow中的content type、multipart、以及压缩（Content-Encoding）的body均仅输出摘要；
+// 没有content type时按内容是否为文本判断。
+type BodyPolicy struct {
+	allow []string
+	deny  []string
+}
+
+func NewBodyPolicy(allow, deny []string) *BodyPolicy {
+	if len(allow) == 0 {
+		allow = DefaultBodyAllow
+	}
+	ret := &BodyPolicy{}
+	for _, v := range allow {
+		ret.allow = append(ret.allow, strings.ToLower(strings.TrimSpace(v)))
+	}
+	for _, v := range deny {
+		ret.deny = append(ret.deny, strings.ToLower(strings.TrimSpace(v)))
+	}
+	return ret
+}
+
+func NewDefaultBodyPolicy() *BodyPolicy {
+	return NewBodyPolicy(nil, nil)
+}
+
+// 根据header判断是否输出body，返回false时输出摘要
+func (p *BodyPolicy) Printable(header http.Header) bool {
+	if p == nil {
+		return true
+	}
+	if enc := header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return false
+	}
+	ct := mediaType(header.Get("Content-Type"))
+	if ct == "" {
+		return true
+	}
+	if strings.HasPrefix(ct, "multipart/") || matchType(p.deny, ct) {
+		return false
+	}
+	return matchType(p.allow, ct)
+}
+
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mt)
+}
+
+func matchType(patterns []string, ct string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, ct); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 内容是否为文本（用于没有content type的body）
+func isText(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size <= 1 {
+			// 忽略被截断的最后一个字符
+			return !utf8.FullRune(b)
+		}
+		if r == 0 {
+			return false
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+// body的摘要，如"image/png: 120KB"、"application/json, gzip: 12KB"
+func summarize(header http.Header, size int64) string {
+	buf := bytes.NewBuffer(nil)
+	ct := mediaType(header.Get("Content-Type"))
+	if ct == "" {
+		ct = "binary"
+	}
+	buf.WriteString(ct)
+	if enc := header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		buf.WriteString(", ")
+		buf.WriteString(enc)
+	}
+	if size > 0 {
+		buf.WriteString(": ")
+		buf.WriteString(formatSize(size))
+	}
+	return buf.String()
+}
+
+// multipart的摘要，如"multipart: 3 parts, file foo.png 120KB"
+func summarizeMultipart(form *multipart.Form, size int64) string {
+	if form == nil {
+		if size > 0 {
+			return "multipart: " + formatSize(size)
+		}
+		return "multipart"
+	}
+	parts := 0
+	for _, vs := range form.Value {
+		parts += len(vs)
+	}
+	keys := make([]string, 0, len(form.File))
+	for k, fs := range form.File {
+		parts += len(fs)
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "multipart: %d parts", parts)
+	for _, k := range keys {
+		for _, f := range form.File[k] {
+			fmt.Fprintf(buf, ", file %s %s", f.Filename, formatSize(f.Size))
+		}
+	}
+	return buf.String()
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return strconv.FormatInt(size, 10) + "B"
+	case size < 1024*1024:
+		return trimZero(float64(size)/1024) + "KB"
+	case size < 1024*1024*1024:
+		return trimZero(float64(size)/1024/1024) + "MB"
+	default:
+		return trimZero(float64(size)/1024/1024/1024) + "GB"
+	}
+}
+
+func trimZero(f float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(f, 'f', 1, 64), ".0")
+}
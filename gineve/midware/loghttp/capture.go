@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"io"
+)
+
+const (
+	DefaultMaxBodySize = 4096
+)
+
+// 最多保存limit字节的body，并统计总字节数
+type bodyCapture struct {
+	buf       *bytes.Buffer
+	limit     int
+	total     int64
+	truncated bool
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.total += int64(len(p))
+	remain := c.limit - c.buf.Len()
+	if len(p) > remain {
+		c.truncated = true
+		if remain > 0 {
+			c.buf.Write(p[:remain])
+		}
+	} else {
+		c.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// 请求body：首先读取的前缀部分重新放回，其余部分直接透传并计数
+type requestBodyReader struct {
+	io.Reader
+	origin io.ReadCloser
+	// 前缀之后读取的字节数
+	count int64
+}
+
+func (r *requestBodyReader) Close() error {
+	return r.origin.Close()
+}
+
+type countReader struct {
+	r *requestBodyReader
+}
+
+func (c countReader) Read(p []byte) (int, error) {
+	n, err := c.r.origin.Read(p)
+	c.r.count += int64(n)
+	return n, err
+}
+
+// 读取最多limit+1字节作为前缀用于日志，并替换原body，实际的请求body不受影响
+func peekRequestBody(c *gin.Context, buf *bytes.Buffer, limit int) (body []byte, read int64, truncated bool, reader *requestBodyReader) {
+	n, _ := io.CopyN(buf, c.Request.Body, int64(limit)+1)
+	body = buf.Bytes()
+	if n > int64(limit) {
+		body = body[:limit]
+		truncated = true
+	}
+	reader = &requestBodyReader{origin: c.Request.Body}
+	reader.Reader = io.MultiReader(buf, countReader{r: reader})
+	c.Request.Body = reader
+	return body, n, truncated, reader
+}
+
+// 不输出body时仅对请求body计数
+func countRequestBody(c *gin.Context) *requestBodyReader {
+	reader := &requestBodyReader{origin: c.Request.Body}
+	reader.Reader = countReader{r: reader}
+	c.Request.Body = reader
+	return reader
+}
+
+type responseBodyWriter struct {
+	gin.ResponseWriter
+	body   *bodyCapture
+	policy *BodyPolicy
+	// 首次写入时根据header判断是否记录body
+	decided bool
+	skip    bool
+}
+
+func newResponseBodyWriter(w gin.ResponseWriter, buf *bytes.Buffer, limit int, policy *BodyPolicy) *responseBodyWriter {
+	return &responseBodyWriter{
+		ResponseWriter: w,
+		body: &bodyCapture{
+			buf:   buf,
+			limit: limit,
+		},
+		policy: policy,
+	}
+}
+
+func (w *responseBodyWriter) capture(b []byte) {
+	if !w.decided {
+		w.decided = true
+		w.skip = !w.policy.Printable(w.Header())
+	}
+	if !w.skip {
+		w.body.Write(b)
+	}
+}
+
+func (w *responseBodyWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.capture(b[:n])
+	return n, err
+}
+
+func (w *responseBodyWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.capture([]byte(s[:n]))
+	return n, err
+}
+
+func (w *responseBodyWriter) getBody() []byte {
+	return w.body.buf.Bytes()
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/ctxkey"
+	"net/http"
+	"time"
+)
+
+const (
+	// handler名称，由handler设置时覆盖gin.Context.HandlerName
+	HandlerKey = ctxkey.Handler
+	// 路由所属的Component名称
+	ComponentKey = ctxkey.Component
+	// 中止请求的原因
+	AbortReasonKey = "_NEVE_LOG_ABORT_REASON"
+)
+
+// 设置中止请求的原因，输出在请求的日志中
+func SetAbortReason(c *gin.Context, reason string) {
+	c.Set(AbortReasonKey, reason)
+}
+
+// 设置中止请求的原因并中止请求
+func AbortWithReason(c *gin.Context, code int, reason string) {
+	SetAbortReason(c, reason)
+	c.AbortWithStatus(code)
+}
+
+// 一次请求/响应的采集数据
+type Exchange struct {
+	RequestId string
+	Start     time.Time
+	Latency   time.Duration
+	// 执行时间超过slowThreshold
+	Slow bool
+
+	Method string
+	// http或者https
+	Scheme string
+	Host   string
+	Path   string
+	// 匹配的路由模板，如/users/:id，未匹配时为空
+	Route string
+	// 处理请求的handler，响应时才有值
+	Handler string
+	// 路由所属的Component
+	Component string
+	// 未匹配到任何路由（404/405）
+	Unmatched bool
+	Query     string
+	ClientIP  string
+	Params    gin.Params
+	Proto     string
+	Referer   string
+	UserAgent string
+
+	RequestContentType string
+	// 开启LogReqHeader时有值
+	RequestHeader http.Header
+	// 开启LogReqBody时有值，最多为MaxBodySize字节
+	RequestBody          []byte
+	RequestBodyTruncated bool
+	// 按content type不输出body时的摘要，如"multipart: 3 parts, file foo.png 120KB"
+	RequestBodySummary string
+	BytesIn            int64
+
+	Status              int
+	ResponseContentType string
+	// 开启LogRespHeader时有值
+	ResponseHeader http.Header
+	// 开启LogRespBody时有值，最多为MaxBodySize字节
+	ResponseBody          []byte
+	ResponseBodyTruncated bool
+	ResponseBodySummary   string
+	BytesOut              int64
+
+	// handler通过gin.Context.Error记录的错误
+	Errors []string
+	// 请求被中止（gin.Context.IsAborted）
+	Aborted     bool
+	AbortReason string
+	// handler panic的值，为空表示未panic
+	Panic string
+}
+
+// 毫秒为单位的执行时间
+func (e *Exchange) LatencyMs() float64 {
+	return float64(e.Latency) / float64(time.Millisecond)
+}
+
+// 深拷贝，采集的body在请求结束后会被回收，需要在请求结束后使用时（如异步输出）使用拷贝
+func (e *Exchange) Clone() *Exchange {
+	ret := *e
+	ret.Params = append(gin.Params(nil), e.Params...)
+	ret.RequestHeader = e.RequestHeader.Clone()
+	ret.RequestBody = copyBytes(e.RequestBody)
+	ret.ResponseHeader = e.ResponseHeader.Clone()
+	ret.ResponseBody = copyBytes(e.ResponseBody)
+	ret.Errors = append([]string(nil), e.Errors...)
+	return &ret
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/fig"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	LogIncludeKey  = "neve.web.log.include"
+	LogExcludeKey  = "neve.web.log.exclude"
+	LogSamplingKey = "neve.web.log.sampling"
+
+	// 为true时日志延迟到请求结束后根据结果决定是否输出：仅输出失败的请求
+	LogDeferKey = "_NEVE_LOG_DEFER"
+)
+
+// 请求匹配规则，格式为"[METHOD ]PATH"，如"GET /items"、"/health"。
+// PATH支持通配符：*匹配一级路径，结尾的/**匹配任意多级路径，如"/static/**"。
+// 同时匹配路由模板（如/items/:id）以及实际的请求路径。
+type RouteMatcher struct {
+	method  string
+	pattern string
+	// 以/**结尾时的前缀
+	prefix   string
+	anyDepth bool
+}
+
+func NewRouteMatcher(rule string) (*RouteMatcher, error) {
+	rule = strings.TrimSpace(rule)
+	ret := &RouteMatcher{}
+	if i := strings.IndexByte(rule, ' '); i > 0 {
+		ret.method = strings.ToUpper(rule[:i])
+		rule = strings.TrimSpace(rule[i+1:])
+	}
+	if !strings.HasPrefix(rule, "/") {
+		return nil, fmt.Errorf("loghttp: invalid route rule %q, path must start with '/'", rule)
+	}
+	if rule == "/**" {
+		ret.anyDepth = true
+		return ret, nil
+	}
+	if strings.HasSuffix(rule, "/**") {
+		ret.anyDepth = true
+		rule = strings.TrimSuffix(rule, "/**")
+	}
+	if _, err := path.Match(rule, ""); err != nil {
+		return nil, fmt.Errorf("loghttp: invalid route rule %q: %v", rule, err)
+	}
+	if ret.anyDepth {
+		ret.prefix = rule
+	} else {
+		ret.pattern = rule
+	}
+	return ret, nil
+}
+
+func (m *RouteMatcher) Match(method, p string) bool {
+	if m.method != "" && m.method != method {
+		return false
+	}
+	if p == "" {
+		return false
+	}
+	if !m.anyDepth {
+		ok, _ := path.Match(m.pattern, p)
+		return ok
+	}
+	if m.prefix == "" {
+		return true
+	}
+	// 取与前缀相同级数的路径匹配
+	n := strings.Count(m.prefix, "/")
+	segs := strings.Split(p, "/")
+	if len(segs) <= n {
+		return false
+	}
+	ok, _ := path.Match(m.prefix, strings.Join(segs[:n+1], "/"))
+	return ok
+}
+
+// 匹配路由模板或者实际的请求路径
+func (m *RouteMatcher) MatchContext(c *gin.Context) bool {
+	return m.Match(c.Request.Method, c.FullPath()) || m.Match(c.Request.Method, c.Request.URL.Path)
+}
+
+func newRouteMatchers(rules []string) ([]*RouteMatcher, error) {
+	var ret []*RouteMatcher
+	for _, r := range rules {
+		m, err := NewRouteMatcher(r)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+func matchAny(ms []*RouteMatcher, c *gin.Context) bool {
+	for _, m := range ms {
+		if m.MatchContext(c) {
+			return true
+		}
+	}
+	return false
+}
+
+type SamplingRule struct {
+	// 匹配规则，参考RouteMatcher
+	Path string
+	// 输出日志的比例，0-1
+	Rate float64
+}
+
+type samplingRule struct {
+	matcher *RouteMatcher
+	rate    float64
+}
+
+// 全局日志的过滤与采样规则：
+// include不为空时仅输出匹配的请求；不输出exclude匹配的请求；
+// sampling按第一条匹配的规则采样，未被采样的请求仅在失败（status >= 400）时输出。
+type LogFilter struct {
+	include  []*RouteMatcher
+	exclude  []*RouteMatcher
+	sampling []samplingRule
+}
+
+func NewLogFilter(include, exclude []string, sampling []SamplingRule) (*LogFilter, error) {
+	ret := &LogFilter{}
+	var err error
+	if ret.include, err = newRouteMatchers(include); err != nil {
+		return nil, err
+	}
+	if ret.exclude, err = newRouteMatchers(exclude); err != nil {
+		return nil, err
+	}
+	for _, s := range sampling {
+		m, err := NewRouteMatcher(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		ret.sampling = append(ret.sampling, samplingRule{matcher: m, rate: s.Rate})
+	}
+	return ret, nil
+}
+
+func NewLogFilterFromConfig(conf fig.Properties) (*LogFilter, error) {
+	var include, exclude []string
+	var sampling []SamplingRule
+	if err := conf.GetValue(LogIncludeKey, &include); err != nil {
+		return nil, err
+	}
+	if err := conf.GetValue(LogExcludeKey, &exclude); err != nil {
+		return nil, err
+	}
+	if err := conf.GetValue(LogSamplingKey, &sampling); err != nil {
+		return nil, err
+	}
+	return NewLogFilter(include, exclude, sampling)
+}
+
+func (f *LogFilter) empty() bool {
+	return f == nil || (len(f.include) == 0 && len(f.exclude) == 0 && len(f.sampling) == 0)
+}
+
+// 按规则包装日志handler
+func (f *LogFilter) Wrap(h gin.HandlerFunc) gin.HandlerFunc {
+	if f.empty() {
+		return h
+	}
+	return func(c *gin.Context) {
+		if (len(f.include) > 0 && !matchAny(f.include, c)) || matchAny(f.exclude, c) {
+			c.Next()
+			return
+		}
+		for _, s := range f.sampling {
+			if s.matcher.MatchContext(c) {
+				if s.rate < 1 && rand.Float64() >= s.rate {
+					c.Set(LogDeferKey, true)
+				}
+				break
+			}
+		}
+		h(c)
+	}
+}
+
+// 延迟输出的请求是否需要输出
+func failed(c *gin.Context, e *Exchange) bool {
+	return e.Status >= http.StatusBadRequest || len(c.Errors) > 0 || e.Panic != ""
+}
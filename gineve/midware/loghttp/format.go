@@ -0,0 +1,427 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogFormatText     = "text"
+	LogFormatJson     = "json"
+	LogFormatLogfmt   = "logfmt"
+	LogFormatCombined = "combined"
+	LogFormatMerged   = "merged"
+)
+
+// 日志格式化接口，buf中写入的内容（不包含换行）作为一行日志输出，未写入内容时不输出
+type Formatter interface {
+	// 请求处理前调用，此时e中仅包含请求相关的数据
+	FormatRequest(buf *bytes.Buffer, e *Exchange)
+	// 请求处理完成后调用
+	FormatResponse(buf *bytes.Buffer, e *Exchange)
+}
+
+var (
+	formatterLock sync.RWMutex
+	formatters    = map[string]Formatter{
+		LogFormatText:     TextFormatter{},
+		LogFormatJson:     JsonFormatter{},
+		LogFormatLogfmt:   LogfmtFormatter{},
+		LogFormatCombined: CombinedFormatter{},
+		LogFormatMerged:   MergedFormatter{},
+	}
+)
+
+// 注册Formatter，可通过neve.web.log.format配置名称使用，同名覆盖
+func RegisterFormatter(name string, f Formatter) {
+	formatterLock.Lock()
+	defer formatterLock.Unlock()
+	formatters[strings.ToLower(name)] = f
+}
+
+// 获得名称为name的Formatter，不存在时返回TextFormatter
+func GetFormatter(name string) Formatter {
+	formatterLock.RLock()
+	defer formatterLock.RUnlock()
+	if f, ok := formatters[strings.ToLower(name)]; ok {
+		return f
+	}
+	return TextFormatter{}
+}
+
+func hasFormatter(name string) bool {
+	formatterLock.RLock()
+	defer formatterLock.RUnlock()
+	_, ok := formatters[strings.ToLower(name)]
+	return ok
+}
+
+// 默认格式，请求和响应分别输出一行
+type TextFormatter struct{}
+
+func (f TextFormatter) FormatRequest(buf *bytes.Buffer, e *Exchange) {
+	buf.WriteString("[Request  ")
+	buf.WriteString(e.RequestId)
+	buf.WriteString("] ")
+	writeTextRequest(buf, e)
+}
+
+func (f TextFormatter) FormatResponse(buf *bytes.Buffer, e *Exchange) {
+	fmt.Fprintf(buf, "[Response %s] [path]: %s , [method]: %s , ", e.RequestId, e.Path, e.Method)
+	writeTextRoute(buf, e)
+	writeTextResponse(buf, e)
+}
+
+// 请求和响应合并输出为一行
+type MergedFormatter struct{}
+
+func (f MergedFormatter) FormatRequest(buf *bytes.Buffer, e *Exchange) {}
+
+func (f MergedFormatter) FormatResponse(buf *bytes.Buffer, e *Exchange) {
+	buf.WriteString("[Exchange ")
+	buf.WriteString(e.RequestId)
+	buf.WriteString("] ")
+	writeTextRequest(buf, e)
+	buf.WriteString(" , ")
+	writeTextResponse(buf, e)
+}
+
+func writeTextRequest(buf *bytes.Buffer, e *Exchange) {
+	fmt.Fprintf(buf, "[path]: %s , [method]: %s , ", e.Path, e.Method)
+	writeTextRoute(buf, e)
+	fmt.Fprintf(buf, "[client ip]: %s ", e.ClientIP)
+	if e.RequestHeader != nil {
+		getHeaderBuffer(buf, e.RequestHeader)
+	}
+	fmt.Fprintf(buf, ", [params]: %v , [query]: %s", e.Params, e.Query)
+	if e.RequestBody != nil {
+		buf.WriteString(" , [data]: ")
+		buf.Write(e.RequestBody)
+		writeTruncated(buf, e.RequestBodyTruncated, e.BytesIn)
+	} else if e.RequestBodySummary != "" {
+		buf.WriteString(" , [data summary]: ")
+		buf.WriteString(e.RequestBodySummary)
+	}
+}
+
+func writeTextRoute(buf *bytes.Buffer, e *Exchange) {
+	if e.Unmatched {
+		buf.WriteString("[unmatched] ")
+		return
+	}
+	fmt.Fprintf(buf, "[route]: %s , ", e.Route)
+	if e.Handler != "" {
+		fmt.Fprintf(buf, "[handler]: %s , ", e.Handler)
+	}
+	if e.Component != "" {
+		fmt.Fprintf(buf, "[component]: %s , ", e.Component)
+	}
+}
+
+func writeTruncated(buf *bytes.Buffer, truncated bool, total int64) {
+	if !truncated {
+		return
+	}
+	if total > 0 {
+		fmt.Fprintf(buf, " ...(truncated, total %d bytes)", total)
+	} else {
+		buf.WriteString(" ...(truncated)")
+	}
+}
+
+func writeTextResponse(buf *bytes.Buffer, e *Exchange) {
+	fmt.Fprintf(buf, "[latency]: %d ms, [status]: %d ", e.Latency/time.Millisecond, e.Status)
+	if e.Slow {
+		buf.WriteString("[slow] ")
+	}
+	writeTextFailure(buf, e)
+	if e.ResponseHeader != nil {
+		getHeaderBuffer(buf, e.ResponseHeader)
+	}
+	if e.ResponseBody != nil {
+		buf.WriteString(" , [data]: ")
+		buf.Write(e.ResponseBody)
+		writeTruncated(buf, e.ResponseBodyTruncated, e.BytesOut)
+	} else if e.ResponseBodySummary != "" {
+		buf.WriteString(" , [data summary]: ")
+		buf.WriteString(e.ResponseBodySummary)
+	}
+}
+
+func writeTextFailure(buf *bytes.Buffer, e *Exchange) {
+	if e.Panic != "" {
+		fmt.Fprintf(buf, "[panic]: %s , ", e.Panic)
+	}
+	if e.Aborted {
+		buf.WriteString("[aborted] ")
+		if e.AbortReason != "" {
+			fmt.Fprintf(buf, "[abort reason]: %s , ", e.AbortReason)
+		}
+	}
+	if len(e.Errors) > 0 {
+		fmt.Fprintf(buf, "[errors]: %s , ", strings.Join(e.Errors, "; "))
+	}
+}
+
+// Apache combined log format:
+// 127.0.0.1 - - [02/Jan/2006:15:04:05 -0700] "GET /users/1?a=b HTTP/1.1" 200 42 "referer" "user agent"
+type CombinedFormatter struct{}
+
+func (f CombinedFormatter) FormatRequest(buf *bytes.Buffer, e *Exchange) {}
+
+func (f CombinedFormatter) FormatResponse(buf *bytes.Buffer, e *Exchange) {
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+	size := "-"
+	if e.BytesOut > 0 {
+		size = strconv.FormatInt(e.BytesOut, 10)
+	}
+	fmt.Fprintf(buf, "%s - - [%s] %q %d %s %q %q",
+		e.ClientIP, e.Start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+uri+" "+e.Proto, e.Status, size, orDash(e.Referer), orDash(e.UserAgent))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// 每个请求输出一条json记录
+type JsonFormatter struct{}
+
+func (f JsonFormatter) FormatRequest(buf *bytes.Buffer, e *Exchange) {}
+
+func (f JsonFormatter) FormatResponse(buf *bytes.Buffer, e *Exchange) {
+	buf.WriteByte('{')
+	writeJsonField(buf, "time", e.Start.Format(time.RFC3339Nano), true)
+	writeJsonField(buf, "request_id", e.RequestId, false)
+	writeJsonField(buf, "method", e.Method, false)
+	writeJsonField(buf, "path", e.Path, false)
+	writeJsonField(buf, "route", e.Route, false)
+	if e.Unmatched {
+		buf.WriteString(`,"unmatched":true`)
+	}
+	if e.Handler != "" {
+		writeJsonField(buf, "handler", e.Handler, false)
+	}
+	if e.Component != "" {
+		writeJsonField(buf, "component", e.Component, false)
+	}
+	if e.Query != "" {
+		writeJsonField(buf, "query", e.Query, false)
+	}
+	buf.WriteString(`,"status":`)
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteString(`,"latency_ms":`)
+	buf.WriteString(strconv.FormatFloat(e.LatencyMs(), 'f', 3, 64))
+	if e.Slow {
+		buf.WriteString(`,"slow":true`)
+	}
+	if e.Panic != "" {
+		writeJsonField(buf, "panic", e.Panic, false)
+	}
+	if e.Aborted {
+		buf.WriteString(`,"aborted":true`)
+		if e.AbortReason != "" {
+			writeJsonField(buf, "abort_reason", e.AbortReason, false)
+		}
+	}
+	if len(e.Errors) > 0 {
+		buf.WriteString(`,"errors":[`)
+		for i, err := range e.Errors {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJsonString(buf, err)
+		}
+		buf.WriteByte(']')
+	}
+	writeJsonField(buf, "client_ip", e.ClientIP, false)
+	if e.UserAgent != "" {
+		writeJsonField(buf, "user_agent", e.UserAgent, false)
+	}
+	buf.WriteString(`,"bytes_in":`)
+	buf.WriteString(strconv.FormatInt(e.BytesIn, 10))
+	buf.WriteString(`,"bytes_out":`)
+	buf.WriteString(strconv.FormatInt(e.BytesOut, 10))
+	if e.RequestHeader != nil {
+		buf.WriteString(`,"request_header":`)
+		writeJsonHeader(buf, e.RequestHeader)
+	}
+	if e.RequestBody != nil {
+		writeJsonField(buf, "request_body", string(e.RequestBody), false)
+		if e.RequestBodyTruncated {
+			buf.WriteString(`,"request_body_truncated":true`)
+		}
+	} else if e.RequestBodySummary != "" {
+		writeJsonField(buf, "request_body_summary", e.RequestBodySummary, false)
+	}
+	if e.ResponseHeader != nil {
+		buf.WriteString(`,"response_header":`)
+		writeJsonHeader(buf, e.ResponseHeader)
+	}
+	if e.ResponseBody != nil {
+		writeJsonField(buf, "response_body", string(e.ResponseBody), false)
+		if e.ResponseBodyTruncated {
+			buf.WriteString(`,"response_body_truncated":true`)
+		}
+	} else if e.ResponseBodySummary != "" {
+		writeJsonField(buf, "response_body_summary", e.ResponseBodySummary, false)
+	}
+	buf.WriteByte('}')
+}
+
+// 每个请求输出一条logfmt（key=value）记录
+type LogfmtFormatter struct{}
+
+func (f LogfmtFormatter) FormatRequest(buf *bytes.Buffer, e *Exchange) {}
+
+func (f LogfmtFormatter) FormatResponse(buf *bytes.Buffer, e *Exchange) {
+	writeLogfmtField(buf, "time", e.Start.Format(time.RFC3339Nano), true)
+	writeLogfmtField(buf, "request_id", e.RequestId, false)
+	writeLogfmtField(buf, "method", e.Method, false)
+	writeLogfmtField(buf, "path", e.Path, false)
+	writeLogfmtField(buf, "route", e.Route, false)
+	if e.Unmatched {
+		writeLogfmtField(buf, "unmatched", "true", false)
+	}
+	if e.Handler != "" {
+		writeLogfmtField(buf, "handler", e.Handler, false)
+	}
+	if e.Component != "" {
+		writeLogfmtField(buf, "component", e.Component, false)
+	}
+	if e.Query != "" {
+		writeLogfmtField(buf, "query", e.Query, false)
+	}
+	writeLogfmtField(buf, "status", strconv.Itoa(e.Status), false)
+	writeLogfmtField(buf, "latency_ms", strconv.FormatFloat(e.LatencyMs(), 'f', 3, 64), false)
+	if e.Slow {
+		writeLogfmtField(buf, "slow", "true", false)
+	}
+	if e.Panic != "" {
+		writeLogfmtField(buf, "panic", e.Panic, false)
+	}
+	if e.Aborted {
+		writeLogfmtField(buf, "aborted", "true", false)
+		if e.AbortReason != "" {
+			writeLogfmtField(buf, "abort_reason", e.AbortReason, false)
+		}
+	}
+	if len(e.Errors) > 0 {
+		writeLogfmtField(buf, "errors", strings.Join(e.Errors, "; "), false)
+	}
+	writeLogfmtField(buf, "client_ip", e.ClientIP, false)
+	if e.UserAgent != "" {
+		writeLogfmtField(buf, "user_agent", e.UserAgent, false)
+	}
+	writeLogfmtField(buf, "bytes_in", strconv.FormatInt(e.BytesIn, 10), false)
+	writeLogfmtField(buf, "bytes_out", strconv.FormatInt(e.BytesOut, 10), false)
+	if e.RequestHeader != nil {
+		writeLogfmtField(buf, "request_header", headerString(e.RequestHeader), false)
+	}
+	if e.RequestBody != nil {
+		writeLogfmtField(buf, "request_body", string(e.RequestBody), false)
+		if e.RequestBodyTruncated {
+			writeLogfmtField(buf, "request_body_truncated", "true", false)
+		}
+	} else if e.RequestBodySummary != "" {
+		writeLogfmtField(buf, "request_body_summary", e.RequestBodySummary, false)
+	}
+	if e.ResponseHeader != nil {
+		writeLogfmtField(buf, "response_header", headerString(e.ResponseHeader), false)
+	}
+	if e.ResponseBody != nil {
+		writeLogfmtField(buf, "response_body", string(e.ResponseBody), false)
+		if e.ResponseBodyTruncated {
+			writeLogfmtField(buf, "response_body_truncated", "true", false)
+		}
+	} else if e.ResponseBodySummary != "" {
+		writeLogfmtField(buf, "response_body_summary", e.ResponseBodySummary, false)
+	}
+}
+
+func writeJsonField(buf *bytes.Buffer, key, value string, first bool) {
+	if !first {
+		buf.WriteByte(',')
+	}
+	writeJsonString(buf, key)
+	buf.WriteByte(':')
+	writeJsonString(buf, value)
+}
+
+func writeJsonString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+func writeJsonHeader(buf *bytes.Buffer, header http.Header) {
+	buf.WriteByte('{')
+	for i, k := range sortedKeys(header) {
+		writeJsonField(buf, k, strings.Join(header[k], ","), i == 0)
+	}
+	buf.WriteByte('}')
+}
+
+func writeLogfmtField(buf *bytes.Buffer, key, value string, first bool) {
+	if !first {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
+
+// 输出为"k1=v1,v2; k2=v3"
+func headerString(header http.Header) string {
+	buf := bytes.NewBuffer(nil)
+	for i, k := range sortedKeys(header) {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(strings.Join(header[k], ","))
+	}
+	return buf.String()
+}
+
+func sortedKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,468 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"github.com/xfali/xlog"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	LogHarKey = "neve.web.log.har"
+
+	HarVersion = "1.2"
+	harCreator = "neve-web"
+)
+
+type harConf struct {
+	// HAR文件路径，为空时不输出到文件
+	Path string
+	// 单个文件的最大大小（MB），超过时切割，0为不限制
+	MaxSize int
+	// 保留的备份文件数，0为不限制
+	MaxBackups int
+	// 写入队列的大小，默认1024
+	QueueSize int
+	// 内存中保留的最近记录数，可通过管理接口下载，0为不保留
+	RingSize int
+}
+
+// HTTP Archive 1.2，参考http://www.softwareishard.com/blog/har-12-spec/
+type HarLog struct {
+	Version string      `json:"version"`
+	Creator HarCreator  `json:"creator"`
+	Entries []*HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HarTimings  `json:"timings"`
+	RequestId       string      `json:"_requestId,omitempty"`
+	Route           string      `json:"_route,omitempty"`
+}
+
+type HarRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HarContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HarTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// 将采集的请求/响应转换为HAR记录，未采集的header、body为空
+func NewHarEntry(e *Exchange) *HarEntry {
+	ret := &HarEntry{
+		StartedDateTime: e.Start.Format(time.RFC3339Nano),
+		Time:            e.LatencyMs(),
+		Timings:         HarTimings{Wait: e.LatencyMs()},
+		RequestId:       e.RequestId,
+		Route:           e.Route,
+	}
+	u := url.URL{Scheme: e.Scheme, Host: e.Host, Path: e.Path, RawQuery: e.Query}
+	ret.Request = HarRequest{
+		Method:      e.Method,
+		URL:         u.String(),
+		HttpVersion: e.Proto,
+		Cookies:     []HarNameValue{},
+		Headers:     harHeaders(e.RequestHeader),
+		QueryString: harQuery(e.Query),
+		HeadersSize: -1,
+		BodySize:    e.BytesIn,
+	}
+	if e.RequestBody != nil || e.RequestBodySummary != "" {
+		ret.Request.PostData = &HarPostData{
+			MimeType: e.RequestContentType,
+			Text:     string(e.RequestBody),
+			Comment:  harComment(e.RequestBodyTruncated, e.RequestBodySummary, e.BytesIn),
+		}
+	}
+	ret.Response = HarResponse{
+		Status:      e.Status,
+		StatusText:  http.StatusText(e.Status),
+		HttpVersion: e.Proto,
+		Cookies:     []HarNameValue{},
+		Headers:     harHeaders(e.ResponseHeader),
+		Content: HarContent{
+			Size:     e.BytesOut,
+			MimeType: e.ResponseContentType,
+			Text:     string(e.ResponseBody),
+			Comment:  harComment(e.ResponseBodyTruncated, e.ResponseBodySummary, e.BytesOut),
+		},
+		RedirectURL: e.ResponseHeader.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    e.BytesOut,
+	}
+	return ret
+}
+
+func harHeaders(header http.Header) []HarNameValue {
+	ret := []HarNameValue{}
+	for _, k := range sortedKeys(header) {
+		for _, v := range header[k] {
+			ret = append(ret, HarNameValue{Name: k, Value: v})
+		}
+	}
+	return ret
+}
+
+func harQuery(query string) []HarNameValue {
+	ret := []HarNameValue{}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ret
+	}
+	for _, k := range sortedKeys(http.Header(values)) {
+		for _, v := range values[k] {
+			ret = append(ret, HarNameValue{Name: k, Value: v})
+		}
+	}
+	return ret
+}
+
+func harComment(truncated bool, summary string, total int64) string {
+	if summary != "" {
+		return summary
+	}
+	if truncated {
+		return fmt.Sprintf("truncated, total %d bytes", total)
+	}
+	return ""
+}
+
+// 将entries输出为完整的HAR文件内容
+func WriteHar(w io.Writer, entries []*HarEntry) error {
+	if entries == nil {
+		entries = []*HarEntry{}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Log HarLog `json:"log"`
+	}{
+		Log: HarLog{
+			Version: HarVersion,
+			Creator: HarCreator{Name: harCreator, Version: HarVersion},
+			Entries: entries,
+		},
+	})
+}
+
+var (
+	harFilePrefix = fmt.Sprintf(`{"log":{"version":%q,"creator":{"name":%q,"version":%q},"entries":[`, HarVersion, harCreator, HarVersion)
+	harFileSuffix = "]}}\n"
+)
+
+type HarOpt func(r *HarFileRecorder)
+
+// 单个文件的最大大小（字节），超过时切割，备份文件名与RotateWriter一致。0为不限制
+func OptHarMaxSize(size int64) HarOpt {
+	return func(r *HarFileRecorder) {
+		r.maxSize = size
+	}
+}
+
+// 保留的备份文件数，0为不限制
+func OptHarMaxBackups(n int) HarOpt {
+	return func(r *HarFileRecorder) {
+		r.maxBackups = n
+	}
+}
+
+// 输出写入失败等后台错误的日志对象，默认为xlog.GetLogger()
+func OptHarLogger(logger xlog.Logger) HarOpt {
+	return func(r *HarFileRecorder) {
+		r.logger = logger
+	}
+}
+
+// 写入队列的大小，默认DefaultAsyncQueueSize，队列满时丢弃新的记录
+func OptHarQueueSize(size int) HarOpt {
+	return func(r *HarFileRecorder) {
+		r.queueSize = size
+	}
+}
+
+// 将记录追加到HAR文件，文件在任意时刻都是完整的HAR：每次写入时覆盖结尾，写入记录后重新写入结尾。
+// 记录通过AsyncSink由单独的协程编码并写入，不阻塞请求。
+type HarFileRecorder struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+	queueSize  int
+	logger     xlog.Logger
+	sink       *AsyncSink
+
+	lock  sync.Mutex
+	file  *os.File
+	size  int64
+	count int
+}
+
+// 创建HAR文件，文件已存在时先将其重命名为备份文件，不会覆盖之前的记录
+func NewHarFileRecorder(filename string, opts ...HarOpt) (*HarFileRecorder, error) {
+	ret := &HarFileRecorder{
+		filename: filename,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if ret.logger == nil {
+		ret.logger = xlog.GetLogger()
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	if fileExists(filename) {
+		if err := os.Rename(filename, backupName(filename, time.Now())); err != nil {
+			return nil, err
+		}
+	}
+	if err := ret.create(); err != nil {
+		return nil, err
+	}
+	sink, err := NewAsyncSink(ret.queueSize, 1, OverflowDropNewest)
+	if err != nil {
+		ret.file.Close()
+		return nil, err
+	}
+	ret.sink = sink
+	return ret, nil
+}
+
+func (r *HarFileRecorder) create() error {
+	f, err := os.OpenFile(r.filename, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(harFilePrefix + harFileSuffix); err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = int64(len(harFilePrefix) + len(harFileSuffix))
+	r.count = 0
+	return nil
+}
+
+func (r *HarFileRecorder) Record(e *Exchange) {
+	r.sink.submit(func(buf *bytes.Buffer) {
+		r.write(e)
+	})
+}
+
+func (r *HarFileRecorder) write(e *Exchange) {
+	b, err := json.Marshal(NewHarEntry(e))
+	if err != nil {
+		r.logger.Errorf("loghttp: marshal har entry failed: %v\n", err)
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return
+	}
+	if r.maxSize > 0 && r.count > 0 && r.size+int64(len(b))+1 > r.maxSize {
+		if err := r.rotate(); err != nil {
+			r.logger.Errorf("loghttp: rotate har failed: %v\n", err)
+			return
+		}
+	}
+	off, err := r.file.Seek(-int64(len(harFileSuffix)), io.SeekEnd)
+	if err != nil {
+		r.logger.Errorf("loghttp: write har failed: %v\n", err)
+		return
+	}
+	data := make([]byte, 0, len(b)+len(harFileSuffix)+1)
+	if r.count > 0 {
+		data = append(data, ',')
+	}
+	data = append(data, b...)
+	data = append(data, harFileSuffix...)
+	if _, err := r.file.Write(data); err != nil {
+		r.logger.Errorf("loghttp: write har failed: %v\n", err)
+		return
+	}
+	r.size = off + int64(len(data))
+	r.count++
+}
+
+func (r *HarFileRecorder) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(r.filename, backupName(r.filename, time.Now())); err != nil {
+		return err
+	}
+	cleanupBackups(r.filename, r.maxBackups, 0)
+	return r.create()
+}
+
+// 写入队列中的记录后关闭文件
+func (r *HarFileRecorder) Close() error {
+	r.sink.Close()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// 写入以及因队列满丢弃的记录数
+func (r *HarFileRecorder) Stats() AsyncStats {
+	return r.sink.Stats()
+}
+
+// 在内存中保留最近的记录，可通过管理接口下载HAR文件
+type HarRing struct {
+	ring *exchangeRing
+}
+
+func NewHarRing(size int) *HarRing {
+	return &HarRing{
+		ring: newExchangeRing(size),
+	}
+}
+
+func (r *HarRing) Record(e *Exchange) {
+	r.ring.add(e)
+}
+
+// 按时间顺序返回保留的记录
+func (r *HarRing) Entries() []*HarEntry {
+	list := r.ring.list()
+	ret := make([]*HarEntry, len(list))
+	for i, e := range list {
+		ret[i] = NewHarEntry(e)
+	}
+	return ret
+}
+
+func (r *HarRing) Reset() {
+	r.ring.reset()
+}
+
+// 注册管理接口：
+// GET /loghttp/har：下载HAR文件
+// DELETE /loghttp/har：清空记录
+func (r *HarRing) AdminRoutes(router gin.IRouter) {
+	router.GET("/loghttp/har", r.downloadHandler)
+	router.DELETE("/loghttp/har", r.resetHandler)
+}
+
+func (r *HarRing) downloadHandler(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.har"`, time.Now().Format("20060102150405")))
+	ctx.Status(http.StatusOK)
+	if err := WriteHar(ctx.Writer, r.Entries()); err != nil {
+		_ = ctx.Error(err)
+	}
+}
+
+func (r *HarRing) resetHandler(ctx *gin.Context) {
+	r.Reset()
+	ret := result.Ok(nil)
+	ret.WriteJson(ctx)
+}
+
+func checkHarConf(conf harConf) error {
+	if conf.MaxSize < 0 || conf.MaxBackups < 0 || conf.QueueSize < 0 || conf.RingSize < 0 {
+		return fmt.Errorf("loghttp: %s maxSize, maxBackups, queueSize and ringSize must not be negative", LogHarKey)
+	}
+	return nil
+}
+
+func newHarRecorders(conf harConf, logger xlog.Logger) ([]Recorder, error) {
+	var ret []Recorder
+	if conf.Path != "" {
+		r, err := NewHarFileRecorder(conf.Path,
+			OptHarMaxSize(int64(conf.MaxSize)*1024*1024),
+			OptHarMaxBackups(conf.MaxBackups),
+			OptHarQueueSize(conf.QueueSize),
+			OptHarLogger(logger))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	if conf.RingSize > 0 {
+		ret = append(ret, NewHarRing(conf.RingSize))
+	}
+	return ret, nil
+}
@@ -0,0 +1,323 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LogInspectorKey = "neve.web.log.inspector"
+
+	DefaultInspectorSize = 100
+)
+
+type inspectorConf struct {
+	Enable bool
+	// 保留最近的请求数，默认为100
+	Size int
+	// 保留的body最大字节数，0为不再限制（采集时已按日志的maxBodySize限制）
+	MaxBodySize int
+}
+
+func checkInspectorConf(conf inspectorConf) error {
+	if conf.Size < 0 || conf.MaxBodySize < 0 {
+		return fmt.Errorf("loghttp: %s size and maxBodySize must not be negative", LogInspectorKey)
+	}
+	return nil
+}
+
+// 在内存中保留最近的请求/响应，通过管理接口查看
+type Inspector struct {
+	ring        *exchangeRing
+	maxBodySize int
+}
+
+// size为保留的请求数，maxBodySize为保留的body最大字节数（0为不限制）
+func NewInspector(size, maxBodySize int) *Inspector {
+	if size <= 0 {
+		size = DefaultInspectorSize
+	}
+	return &Inspector{
+		ring:        newExchangeRing(size),
+		maxBodySize: maxBodySize,
+	}
+}
+
+func (i *Inspector) Record(e *Exchange) {
+	if i.maxBodySize > 0 && (len(e.RequestBody) > i.maxBodySize || len(e.ResponseBody) > i.maxBodySize) {
+		// e为共享的记录，不能修改
+		cp := *e
+		if len(cp.RequestBody) > i.maxBodySize {
+			cp.RequestBody = cp.RequestBody[:i.maxBodySize]
+			cp.RequestBodyTruncated = true
+		}
+		if len(cp.ResponseBody) > i.maxBodySize {
+			cp.ResponseBody = cp.ResponseBody[:i.maxBodySize]
+			cp.ResponseBodyTruncated = true
+		}
+		e = &cp
+	}
+	i.ring.add(e)
+}
+
+type InspectorFilter struct {
+	// path前缀，或者与路由模板相同
+	Path string
+	// 状态码，如404，或者状态码类别，如4xx
+	Status    string
+	RequestId string
+	// 最多返回的记录数，0为不限制
+	Limit int
+}
+
+func (f InspectorFilter) match(e *Exchange) bool {
+	if f.RequestId != "" && e.RequestId != f.RequestId {
+		return false
+	}
+	if f.Path != "" && !strings.HasPrefix(e.Path, f.Path) && e.Route != f.Path {
+		return false
+	}
+	if f.Status != "" {
+		s := strconv.Itoa(e.Status)
+		if strings.HasSuffix(strings.ToLower(f.Status), "xx") {
+			return len(s) == 3 && s[0] == f.Status[0]
+		}
+		return s == f.Status
+	}
+	return true
+}
+
+func (f InspectorFilter) validate() error {
+	if f.Status == "" {
+		return nil
+	}
+	s := strings.ToLower(f.Status)
+	if len(s) == 3 && s[0] >= '1' && s[0] <= '5' && (s[1:] == "xx" || isDigits(s[1:])) {
+		return nil
+	}
+	return fmt.Errorf("loghttp: invalid status filter %q, expect code like 404 or class like 4xx", f.Status)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 按条件查找保留的请求，最近的在前
+func (i *Inspector) Find(filter InspectorFilter) []*Exchange {
+	list := i.ring.list()
+	var ret []*Exchange
+	for j := len(list) - 1; j >= 0; j-- {
+		if !filter.match(list[j]) {
+			continue
+		}
+		ret = append(ret, list[j])
+		if filter.Limit > 0 && len(ret) >= filter.Limit {
+			break
+		}
+	}
+	return ret
+}
+
+func (i *Inspector) Reset() {
+	i.ring.reset()
+}
+
+// 注册管理接口，查询参数path、status、requestId、limit用于过滤：
+// GET /loghttp/inspector：json格式的记录
+// GET /loghttp/inspector/view：html页面
+// DELETE /loghttp/inspector：清空记录
+func (i *Inspector) AdminRoutes(router gin.IRouter) {
+	router.GET("/loghttp/inspector", i.listHandler)
+	router.GET("/loghttp/inspector/view", i.viewHandler)
+	router.DELETE("/loghttp/inspector", i.resetHandler)
+}
+
+type inspectorRecord struct {
+	RequestId      string      `json:"requestId"`
+	Time           time.Time   `json:"time"`
+	LatencyMs      float64     `json:"latencyMs"`
+	Method         string      `json:"method"`
+	Path           string      `json:"path"`
+	Route          string      `json:"route,omitempty"`
+	Query          string      `json:"query,omitempty"`
+	ClientIP       string      `json:"clientIp"`
+	Status         int         `json:"status"`
+	RequestHeader  http.Header `json:"requestHeader,omitempty"`
+	RequestBody    string      `json:"requestBody,omitempty"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	ResponseBody   string      `json:"responseBody,omitempty"`
+	BytesIn        int64       `json:"bytesIn"`
+	BytesOut       int64       `json:"bytesOut"`
+	Errors         []string    `json:"errors,omitempty"`
+	AbortReason    string      `json:"abortReason,omitempty"`
+	Panic          string      `json:"panic,omitempty"`
+}
+
+func newInspectorRecord(e *Exchange) inspectorRecord {
+	return inspectorRecord{
+		RequestId:      e.RequestId,
+		Time:           e.Start,
+		LatencyMs:      e.LatencyMs(),
+		Method:         e.Method,
+		Path:           e.Path,
+		Route:          e.Route,
+		Query:          e.Query,
+		ClientIP:       e.ClientIP,
+		Status:         e.Status,
+		RequestHeader:  e.RequestHeader,
+		RequestBody:    inspectorBody(e.RequestBody, e.RequestBodyTruncated, e.RequestBodySummary),
+		ResponseHeader: e.ResponseHeader,
+		ResponseBody:   inspectorBody(e.ResponseBody, e.ResponseBodyTruncated, e.ResponseBodySummary),
+		BytesIn:        e.BytesIn,
+		BytesOut:       e.BytesOut,
+		Errors:         e.Errors,
+		AbortReason:    e.AbortReason,
+		Panic:          e.Panic,
+	}
+}
+
+func inspectorBody(body []byte, truncated bool, summary string) string {
+	if body == nil {
+		return summary
+	}
+	if truncated {
+		return string(body) + " ...(truncated)"
+	}
+	return string(body)
+}
+
+func (i *Inspector) find(ctx *gin.Context) ([]inspectorRecord, InspectorFilter, error) {
+	filter := InspectorFilter{
+		Path:      ctx.Query("path"),
+		Status:    ctx.Query("status"),
+		RequestId: ctx.Query("requestId"),
+	}
+	if v := ctx.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, filter, err
+		}
+		filter.Limit = n
+	}
+	if err := filter.validate(); err != nil {
+		return nil, filter, err
+	}
+	list := i.Find(filter)
+	ret := make([]inspectorRecord, len(list))
+	for j, e := range list {
+		ret[j] = newInspectorRecord(e)
+	}
+	return ret, filter, nil
+}
+
+func (i *Inspector) listHandler(ctx *gin.Context) {
+	records, _, err := i.find(ctx)
+	if err != nil {
+		result.BadRequestError.Clone().SetMessage(err.Error()).WriteJson(ctx)
+		return
+	}
+	ret := result.Ok(records)
+	ret.WriteJson(ctx)
+}
+
+func (i *Inspector) viewHandler(ctx *gin.Context) {
+	records, filter, err := i.find(ctx)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	err = inspectorTemplate.Execute(ctx.Writer, struct {
+		Filter  InspectorFilter
+		Records []inspectorRecord
+	}{
+		Filter:  filter,
+		Records: records,
+	})
+	if err != nil {
+		_ = ctx.Error(err)
+	}
+}
+
+func (i *Inspector) resetHandler(ctx *gin.Context) {
+	i.Reset()
+	ret := result.Ok(nil)
+	ret.WriteJson(ctx)
+}
+
+var inspectorTemplate = template.Must(template.New("inspector").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Recent traffic</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 16px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+pre { white-space: pre-wrap; word-break: break-all; margin: 4px 0; }
+.s2 { color: #080; } .s3 { color: #06c; } .s4 { color: #c60; } .s5 { color: #c00; }
+</style>
+</head>
+<body>
+<form method="get">
+path <input name="path" value="{{.Filter.Path}}">
+status <input name="status" size="4" value="{{.Filter.Status}}">
+request id <input name="requestId" value="{{.Filter.RequestId}}">
+<button type="submit">filter</button>
+</form>
+<p>{{len .Records}} records</p>
+<table>
+<tr><th>time</th><th>request id</th><th>method</th><th>path</th><th>status</th><th>latency</th><th>detail</th></tr>
+{{range .Records}}
+<tr>
+<td>{{.Time.Format "15:04:05.000"}}</td>
+<td><a href="?requestId={{.RequestId}}">{{.RequestId}}</a></td>
+<td>{{.Method}}</td>
+<td>{{.Path}}{{if .Query}}?{{.Query}}{{end}}{{if .Route}}<br><small>{{.Route}}</small>{{end}}</td>
+<td class="s{{printf "%.1s" (printf "%d" .Status)}}">{{.Status}}</td>
+<td>{{printf "%.3f" .LatencyMs}} ms</td>
+<td><details><summary>{{.BytesIn}} B in / {{.BytesOut}} B out</summary>
+{{if .Panic}}<pre>panic: {{.Panic}}</pre>{{end}}
+{{if .AbortReason}}<pre>abort: {{.AbortReason}}</pre>{{end}}
+{{range .Errors}}<pre>error: {{.}}</pre>{{end}}
+{{if .RequestHeader}}<b>request header</b><pre>{{range $k, $v := .RequestHeader}}{{$k}}: {{range $v}}{{.}} {{end}}
+{{end}}</pre>{{end}}
+{{if .RequestBody}}<b>request body</b><pre>{{.RequestBody}}</pre>{{end}}
+{{if .ResponseHeader}}<b>response header</b><pre>{{range $k, $v := .ResponseHeader}}{{$k}}: {{range $v}}{{.}} {{end}}
+{{end}}</pre>{{end}}
+{{if .ResponseBody}}<b>response body</b><pre>{{.ResponseBody}}</pre>{{end}}
+</details></td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
@@ -18,28 +18,33 @@ package loghttp
 
 import (
 	"bytes"
-	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/gin-gonic/gin/binding"
 	"github.com/xfali/fig"
-	"github.com/xfali/goutils/idUtil"
 	"github.com/xfali/neve-web/buffer"
+	"github.com/xfali/neve-web/gineve/midware/recovery"
+	"github.com/xfali/neve-web/gineve/midware/requestid"
 	"github.com/xfali/xlog"
 	"io"
 	"net/http"
-	"reflect"
+	"runtime/debug"
 	"strings"
 	"time"
 )
 
 const (
-	REQEUST_ID = "_REQEUST_ID"
-
-	LogReqHeaderKey  = "neve.web.log.requestHeader"
-	LogReqBodyKey    = "neve.web.log.requestBody"
-	LogRespHeaderKey = "neve.web.log.responseHeader"
-	LogRespBodyKey   = "neve.web.log.responseBody"
-	LogLevelKey      = "neve.web.log.level"
+	REQEUST_ID = requestid.Key
+
+	LogReqHeaderKey     = "neve.web.log.requestHeader"
+	LogReqBodyKey       = "neve.web.log.requestBody"
+	LogRespHeaderKey    = "neve.web.log.responseHeader"
+	LogRespBodyKey      = "neve.web.log.responseBody"
+	LogLevelKey         = "neve.web.log.level"
+	LogFormatKey        = "neve.web.log.format"
+	LogFormatterKey     = "neve.web.log.formatter"
+	LogMaxBodySizeKey   = "neve.web.log.maxBodySize"
+	LogSlowThresholdKey = "neve.web.log.slowThreshold"
+	LogFixedLevelKey    = "neve.web.log.fixedLevel"
 
 	LogLevelDebug = "debug"
 	LogLevelInfo  = "info"
@@ -133,32 +138,6 @@ func (w *responseBodyLogWrapper) purge() {
 	w.body = nil
 }
 
-type RequestBodyLogWriter struct {
-	Logger xlog.Logger
-	V      binding.StructValidator
-}
-
-func (v *RequestBodyLogWriter) ValidateStruct(obj interface{}) error {
-	valueType := reflect.TypeOf(obj)
-	if valueType.Kind() == reflect.Ptr {
-		valueType = valueType.Elem()
-	}
-	if valueType.Kind() == reflect.Struct {
-		b, err := json.Marshal(obj)
-		if err != nil {
-			v.Logger.Infof("Request Log bind body error: %s\n", err.Error())
-		} else {
-			v.Logger.Infof("Request Log bind body is %s\n", string(b))
-		}
-	}
-
-	return v.V.ValidateStruct(obj)
-}
-
-func (v *RequestBodyLogWriter) Engine() interface{} {
-	return v.V.Engine()
-}
-
 type LogHttpUtil struct {
 	Logger xlog.Logger
 
@@ -173,6 +152,14 @@ type LogHttpUtil struct {
 	LogRespBody bool `fig:"log.responseBody"`
 	// log level
 	Level string `fig:"log.level"`
+	// log format: text(default), json, logfmt
+	Format string `fig:"log.format"`
+	// max bytes of body to log, default 4096
+	MaxBodySize int `fig:"log.maxBodySize"`
+	// requests slower than this (ms) are logged at warn level, 0 to disable
+	SlowThreshold int `fig:"log.slowThreshold"`
+	// always log at the configured level regardless of the status and latency
+	FixedLevel bool `fig:"log.fixedLevel"`
 
 	logFunc logFunc
 }
@@ -208,6 +195,10 @@ func (util *LogHttpUtil) clone(opts ...LogOpt) *LogHttpUtil {
 	ret.LogRespHeader = util.LogRespHeader
 	ret.LogRespBody = util.LogRespBody
 	ret.Level = util.Level
+	ret.Format = util.Format
+	ret.MaxBodySize = util.MaxBodySize
+	ret.SlowThreshold = util.SlowThreshold
+	ret.FixedLevel = util.FixedLevel
 
 	for _, opt := range opts {
 		opt(ret)
@@ -244,6 +235,26 @@ func (util *LogHttpUtil) Set(key string, value interface{}) {
 			util.Level = v
 		}
 		break
+	case LogFormatKey:
+		if v, ok := value.(string); ok {
+			util.Format = v
+		}
+		break
+	case LogMaxBodySizeKey:
+		if v, ok := value.(int); ok {
+			util.MaxBodySize = v
+		}
+		break
+	case LogSlowThresholdKey:
+		if v, ok := value.(int); ok {
+			util.SlowThreshold = v
+		}
+		break
+	case LogFixedLevelKey:
+		if v, ok := value.(bool); ok {
+			util.FixedLevel = v
+		}
+		break
 	}
 }
 
@@ -253,7 +264,7 @@ func (util *LogHttpUtil) log(c *gin.Context) {
 	path := c.Request.URL.Path
 	clientIP := c.ClientIP()
 	method := c.Request.Method
-	requestId := idUtil.RandomId(16)
+	requestId := requestid.GetOrCreate(c)
 	params := c.Params
 	querys := c.Request.URL.RawQuery
 	reqHeader := ""
@@ -261,8 +272,6 @@ func (util *LogHttpUtil) log(c *gin.Context) {
 		reqHeader = getHeaderStr(c.Request.Header)
 	}
 
-	//c.Set(REQEUST_ID, requestId)
-
 	var rbw *requestBodyWrapper = nil
 	if util.LogReqBody {
 		rbw = newRequestBodyWrapper(c.Request.Body)
@@ -364,15 +373,127 @@ func (util *LogHttpUtil) initLog() {
 
 type hLogger struct {
 	LogHttpUtil
-	pool buffer.Pool
+	pool       buffer.Pool
+	formatter  Formatter
+	redactor   *Redactor
+	bodyPolicy *BodyPolicy
+	sink       *AsyncSink
+	// 不为nil时日志直接输出到writer，不使用Logger
+	writer    io.Writer
+	routes    []routeSetting
+	runtime   *Runtime
+	recorders []Recorder
+}
+
+// 校验neve.web.log的配置（日志级别、格式、脱敏、body、异步输出、路由、文件、HAR以及inspector），不创建任何资源
+func CheckConfig(conf fig.Properties) error {
+	if err := checkLevel(conf.Get(LogLevelKey, "")); err != nil {
+		return err
+	}
+	if format := conf.Get(LogFormatKey, ""); format != "" && !hasFormatter(format) {
+		return fmt.Errorf("loghttp: unknown format %q", format)
+	}
+	rc := redactConf{}
+	if err := conf.GetValue(LogRedactKey, &rc); err != nil {
+		return err
+	}
+	if _, err := redactorFromConfig(rc); err != nil {
+		return err
+	}
+	bc := bodyConf{}
+	if err := conf.GetValue(LogBodyKey, &bc); err != nil {
+		return err
+	}
+	if _, err := asyncSinkConfig(conf); err != nil {
+		return err
+	}
+	var routes []RouteSetting
+	if err := conf.GetValue(LogRoutesKey, &routes); err != nil {
+		return err
+	}
+	if _, err := compileRouteSettings(routes); err != nil {
+		return err
+	}
+	for _, rs := range routes {
+		if err := checkLevel(rs.Level); err != nil {
+			return err
+		}
+	}
+	fc := fileConf{}
+	if err := conf.GetValue(LogFileKey, &fc); err != nil {
+		return err
+	}
+	if err := checkFileConf(fc); err != nil {
+		return err
+	}
+	hc := harConf{}
+	if err := conf.GetValue(LogHarKey, &hc); err != nil {
+		return err
+	}
+	if err := checkHarConf(hc); err != nil {
+		return err
+	}
+	ic := inspectorConf{}
+	if err := conf.GetValue(LogInspectorKey, &ic); err != nil {
+		return err
+	}
+	return checkInspectorConf(ic)
 }
 
-func NewFromConfig(conf fig.Properties, logger xlog.Logger) *hLogger {
+// 按neve.web.log配置创建HttpLogger，配置错误（参考CheckConfig）或者无法创建日志文件、HAR文件时返回错误
+func NewFromConfig(conf fig.Properties, logger xlog.Logger) (*hLogger, error) {
+	if err := CheckConfig(conf); err != nil {
+		return nil, err
+	}
 	ret := &hLogger{
 		LogHttpUtil: *NewLogHttpUtil(conf, logger),
 		pool:        buffer.NewPool(),
+		runtime:     NewRuntime(),
 	}
-	return ret
+	rc := redactConf{}
+	_ = conf.GetValue(LogRedactKey, &rc)
+	ret.redactor, _ = redactorFromConfig(rc)
+	bc := bodyConf{}
+	_ = conf.GetValue(LogBodyKey, &bc)
+	ret.bodyPolicy = NewBodyPolicy(bc.Allow, bc.Deny)
+	var routes []RouteSetting
+	_ = conf.GetValue(LogRoutesKey, &routes)
+	ret.routes, _ = compileRouteSettings(routes)
+
+	err := ret.openFromConfig(conf)
+	if err != nil {
+		_ = ret.Close()
+		return nil, err
+	}
+	ret.initFormatter()
+	return ret, nil
+}
+
+// 创建异步输出、日志文件以及Recorder
+func (util *hLogger) openFromConfig(conf fig.Properties) error {
+	var err error
+	if util.sink, err = asyncSinkFromConfig(conf); err != nil {
+		return err
+	}
+	fc := fileConf{}
+	_ = conf.GetValue(LogFileKey, &fc)
+	if fc.Path != "" {
+		if util.writer, err = newRotateWriterFromConfig(fc, util.Logger); err != nil {
+			util.writer = nil
+			return err
+		}
+	}
+	hc := harConf{}
+	_ = conf.GetValue(LogHarKey, &hc)
+	if util.recorders, err = newHarRecorders(hc, util.Logger); err != nil {
+		return err
+	}
+	ic := inspectorConf{}
+	_ = conf.GetValue(LogInspectorKey, &ic)
+	if ic.Enable {
+		util.recorders = append(util.recorders, NewInspector(ic.Size, ic.MaxBodySize))
+	}
+	return nil
 }
 
 func NewHttpLogger(logger xlog.Logger, opts ...LogOpt) *hLogger {
@@ -384,12 +505,16 @@ func NewHttpLogger(logger xlog.Logger, opts ...LogOpt) *hLogger {
 	ret.LogRespBody = true
 	ret.Level = "info"
 	ret.pool = buffer.NewPool()
+	ret.redactor = NewDefaultRedactor()
+	ret.bodyPolicy = NewDefaultBodyPolicy()
+	ret.runtime = NewRuntime()
 
 	for _, opt := range opts {
 		opt(ret)
 	}
 
 	ret.initLog()
+	ret.initFormatter()
 	return ret
 }
 
@@ -401,16 +526,90 @@ func (util *hLogger) clone(opts ...LogOpt) *hLogger {
 	ret.LogRespHeader = util.LogRespHeader
 	ret.LogRespBody = util.LogRespBody
 	ret.Level = util.Level
+	ret.Format = util.Format
+	ret.MaxBodySize = util.MaxBodySize
+	ret.SlowThreshold = util.SlowThreshold
+	ret.FixedLevel = util.FixedLevel
 	ret.pool = util.pool
+	ret.formatter = util.formatter
+	ret.redactor = util.redactor
+	ret.bodyPolicy = util.bodyPolicy
+	ret.sink = util.sink
+	ret.writer = util.writer
+	ret.routes = util.routes
+	ret.runtime = util.runtime
+	ret.recorders = util.recorders
 
 	for _, opt := range opts {
 		opt(ret)
 	}
 
 	ret.initLog()
+	ret.initFormatter()
 	return ret
 }
 
+func (util *hLogger) Set(key string, value interface{}) {
+	switch key {
+	case LogFormatterKey:
+		if v, ok := value.(Formatter); ok {
+			util.formatter = v
+		}
+		return
+	case LogRedactorKey:
+		if v, ok := value.(*Redactor); ok {
+			util.redactor = v
+		}
+		return
+	case LogBodyPolicyKey:
+		if v, ok := value.(*BodyPolicy); ok {
+			util.bodyPolicy = v
+		}
+		return
+	case LogAsyncSinkKey:
+		if v, ok := value.(*AsyncSink); ok {
+			util.sink = v
+		}
+		return
+	case LogWriterKey:
+		if v, ok := value.(io.Writer); ok {
+			util.writer = v
+		}
+		return
+	case LogRuntimeKey:
+		if v, ok := value.(*Runtime); ok && v != nil {
+			util.runtime = v
+		}
+		return
+	case LogRoutesKey:
+		if v, ok := value.([]RouteSetting); ok {
+			routes, err := compileRouteSettings(v)
+			if err != nil {
+				util.Logger.Errorln(err)
+				return
+			}
+			util.routes = routes
+		}
+		return
+	case LogRecorderKey:
+		if v, ok := value.(Recorder); ok {
+			// 不修改Clone来源的HttpLogger
+			util.recorders = append(append([]Recorder{}, util.recorders...), v)
+		}
+		return
+	case LogFormatKey:
+		// 按名称重新选择Formatter
+		util.formatter = nil
+	}
+	util.LogHttpUtil.Set(key, value)
+}
+
+func (util *hLogger) initFormatter() {
+	if util.formatter == nil {
+		util.formatter = GetFormatter(util.Format)
+	}
+}
+
 func (util *hLogger) LogHttp() gin.HandlerFunc {
 	return util.log
 }
@@ -424,104 +623,295 @@ func (util *hLogger) Clone(opts ...LogOpt) HttpLogger {
 }
 
 func (util *hLogger) log(c *gin.Context) {
-	start := time.Now()
-
-	path := c.Request.URL.Path
-	clientIP := c.ClientIP()
-	method := c.Request.Method
-	requestId := idUtil.RandomId(16)
-	params := c.Params
-	querys := c.Request.URL.RawQuery
-	reqHeaderBuf := util.pool.Get()
-	defer util.pool.Put(reqHeaderBuf)
-	if util.LogReqHeader {
-		getHeaderBuffer(reqHeaderBuf, c.Request.Header)
+	s := util.settings(c)
+	e := &Exchange{
+		RequestId: requestid.GetOrCreate(c),
+		Start:     time.Now(),
+		Method:    c.Request.Method,
+		Scheme:    "http",
+		Host:      c.Request.Host,
+		Path:      c.Request.URL.Path,
+		Route:     c.FullPath(),
+		Component: c.GetString(ComponentKey),
+		Query:     c.Request.URL.RawQuery,
+		ClientIP:  c.ClientIP(),
+		Params:    c.Params,
+		Proto:     c.Request.Proto,
+		Referer:   c.Request.Referer(),
+		UserAgent: c.Request.UserAgent(),
+		BytesIn:   c.Request.ContentLength,
+
+		RequestContentType: c.GetHeader("Content-Type"),
+	}
+	e.Unmatched = e.Route == ""
+	if c.Request.TLS != nil {
+		e.Scheme = "https"
+	}
+	if e.BytesIn < 0 {
+		e.BytesIn = 0
+	}
+	if s.reqHeader {
+		e.RequestHeader = c.Request.Header.Clone()
 	}
 
-	//c.Set(REQEUST_ID, requestId)
+	limit := util.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
 
-	reqBody := ""
-	if util.LogReqBody {
-		reqBodyWrapper := buffer.NewReadWriteCloser(util.pool)
-		io.Copy(reqBodyWrapper, c.Request.Body)
-		c.Request.Body.Close()
-		reqBody = string(reqBodyWrapper.Bytes())
-		c.Request.Body = reqBodyWrapper
-		// Must close here to release buffer.
-		defer reqBodyWrapper.Close()
+	var reqBody *requestBodyReader
+	var peekLen int64
+	if s.reqBody && c.Request.Body != nil {
+		if util.bodyPolicy.Printable(c.Request.Header) {
+			peekBuf := util.pool.Get()
+			defer util.pool.Put(peekBuf)
+			e.RequestBody, peekLen, e.RequestBodyTruncated, reqBody = peekRequestBody(c, peekBuf, limit)
+			if !e.RequestBodyTruncated {
+				e.BytesIn = peekLen
+			}
+			if e.RequestContentType == "" && !isText(e.RequestBody) {
+				e.RequestBody = nil
+				e.RequestBodySummary = summarize(c.Request.Header, e.BytesIn)
+			}
+		} else {
+			reqBody = countRequestBody(c)
+			e.RequestBodySummary = util.summarizeRequest(c, e.BytesIn)
+		}
 	}
 
 	var blw *responseBodyWriter
-	if util.LogRespBody {
-		blw = newResponseBodyWriter(c.Writer, buffer.NewReadWriteCloser(util.pool))
+	if s.respBody {
+		respBuf := util.pool.Get()
+		defer util.pool.Put(respBuf)
+		blw = newResponseBodyWriter(c.Writer, respBuf, limit, util.bodyPolicy)
 		c.Writer = blw
-		defer blw.Close()
 	}
 
-	if util.LogReqBody {
-		util.output("[Request  %s] [path]: %s , [method]: %s , [client ip]: %s %s, [params]: %v , [query]: %s , [data]: %s\n",
-			requestId, path, method, clientIP, reqHeaderBuf.String(), params, querys, reqBody)
-	} else {
-		util.output("[Request  %s] [path]: %s , [method]: %s , [client ip]: %s %s, [params]: %v , [query]: %s\n",
-			requestId, path, method, clientIP, reqHeaderBuf.String(), params, querys)
+	util.redactor.RedactRequest(e)
+	deferred := c.GetBool(LogDeferKey)
+	if !deferred {
+		util.emit(e, true, s.level)
 	}
 
-	// 处理请求
-	c.Next()
+	// 处理请求，panic时先输出日志再继续panic，由recovery处理
+	if p, panicked := next(c); panicked {
+		e.Panic = fmt.Sprint(p)
+		defer panic(p)
+	} else if p, ok := c.Get(recovery.PanicKey); ok {
+		e.Panic = fmt.Sprint(p)
+	}
 
-	// 结束时间
-	end := time.Now()
 	//执行时间
-	latency := end.Sub(start)
-
-	statusCode := c.Writer.Status()
-
-	var data string
-	if util.LogRespBody {
-		data = string(blw.getBody())
+	e.Latency = time.Since(e.Start)
+	e.Slow = util.SlowThreshold > 0 && e.Latency > time.Duration(util.SlowThreshold)*time.Millisecond
+	e.Status = c.Writer.Status()
+	if e.Panic != "" && !c.Writer.Written() {
+		// recovery尚未写入响应
+		e.Status = http.StatusInternalServerError
 	}
-	respHeaderBuf := util.pool.Get()
-	defer util.pool.Put(respHeaderBuf)
-	if util.LogRespHeader {
+	if len(c.Errors) > 0 {
+		e.Errors = c.Errors.Errors()
+	}
+	e.Aborted = c.IsAborted()
+	e.AbortReason = c.GetString(AbortReasonKey)
+	e.ResponseContentType = c.Writer.Header().Get("Content-Type")
+	if !e.Unmatched {
+		e.Handler = c.GetString(HandlerKey)
+		if e.Handler == "" {
+			e.Handler = c.HandlerName()
+		}
+	}
+	if size := c.Writer.Size(); size > 0 {
+		e.BytesOut = int64(size)
+	}
+	if s.respHeader {
 		rh := c.Writer.Header()
 		if rh != nil {
-			getHeaderBuffer(respHeaderBuf, rh.Clone())
+			e.ResponseHeader = rh.Clone()
+		}
+	}
+	if reqBody != nil && peekLen+reqBody.count > e.BytesIn {
+		e.BytesIn = peekLen + reqBody.count
+	}
+	if e.RequestBodySummary != "" {
+		// handler解析multipart后可获得更详细的摘要
+		e.RequestBodySummary = util.summarizeRequest(c, e.BytesIn)
+	}
+	if s.respBody {
+		if blw.skip {
+			e.ResponseBodySummary = summarize(blw.Header(), e.BytesOut)
+		} else {
+			e.ResponseBody = blw.getBody()
+			e.ResponseBodyTruncated = blw.body.truncated
+			if e.ResponseContentType == "" && !isText(e.ResponseBody) {
+				e.ResponseBody = nil
+				e.ResponseBodySummary = summarize(blw.Header(), e.BytesOut)
+			}
 		}
 	}
-	util.output("[Response %s] [path]: %s , [method]: %s , [latency]: %d ms, [status]: %d %s%s\n",
-		requestId, path, method, latency/time.Millisecond, statusCode, respHeaderBuf.String(), data)
+
+	lv := util.responseLevel(e, s.level)
+	// 被采样忽略的请求仍然记录到Recorder
+	logged := !deferred || failed(c, e)
+	if deferred && logged {
+		util.emit(e, true, lv)
+	}
+
+	util.redactor.RedactResponse(e)
+	if logged {
+		util.emit(e, false, lv)
+	}
+	util.record(e)
 }
 
-type responseBodyWriter struct {
-	gin.ResponseWriter
-	body *buffer.ReadWriteCloser
+func (util *hLogger) record(e *Exchange) {
+	if len(util.recorders) == 0 {
+		return
+	}
+	cp := e.Clone()
+	for _, r := range util.recorders {
+		r.Record(cp)
+	}
 }
 
-func newResponseBodyWriter(w gin.ResponseWriter, rwc *buffer.ReadWriteCloser) *responseBodyWriter {
-	ret := &responseBodyWriter{
-		ResponseWriter: w,
-		body:           rwc,
+// 输出请求（request为true）或者响应日志，异步输出时使用e的拷贝
+func (util *hLogger) emit(e *Exchange, request bool, lv string) {
+	if util.sink == nil {
+		buf := util.pool.Get()
+		defer util.pool.Put(buf)
+		util.write(buf, e, request, lv)
+		return
 	}
-	ret.body.Write([]byte(" , [data]: "))
-	return ret
+	cp := e.Clone()
+	util.sink.submit(func(buf *bytes.Buffer) {
+		util.write(buf, cp, request, lv)
+	})
 }
 
-func (w *responseBodyWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+func (util *hLogger) write(buf *bytes.Buffer, e *Exchange, request bool, lv string) {
+	if request {
+		util.formatter.FormatRequest(buf, e)
+	} else {
+		util.formatter.FormatResponse(buf, e)
+	}
+	if buf.Len() == 0 {
+		return
+	}
+	if util.writer != nil {
+		buf.WriteByte('\n')
+		if _, err := util.writer.Write(buf.Bytes()); err != nil {
+			util.Logger.Errorln(err)
+		}
+		return
+	}
+	util.outputLevel(lv, "%s\n", buf.String())
 }
 
-func (w *responseBodyWriter) WriteString(s string) (int, error) {
-	w.body.Write([]byte(s))
-	return w.ResponseWriter.WriteString(s)
+// 异步输出时等待队列中的日志输出完成，并关闭日志文件
+func (util *hLogger) Close() error {
+	var err error
+	if util.sink != nil {
+		err = util.sink.Close()
+	}
+	if c, ok := util.writer.(io.Closer); ok {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for _, r := range util.recorders {
+		if c, ok := r.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// 获得运行时配置，与Clone的HttpLogger共享
+func (util *hLogger) Runtime() *Runtime {
+	return util.runtime
+}
+
+// 获得请求结束后接收记录的Recorder
+func (util *hLogger) Recorders() []Recorder {
+	return util.recorders
+}
+
+// 获得日志使用的Redactor
+func (util *hLogger) Redactor() *Redactor {
+	return util.redactor
+}
+
+// 获得异步输出的AsyncSink（可通过Stats获得统计），未开启异步输出时返回nil
+func (util *hLogger) Sink() *AsyncSink {
+	return util.sink
+}
+
+// 执行后续的handler，返回是否panic以及panic的值
+func next(c *gin.Context) (p interface{}, panicked bool) {
+	panicked = true
+	defer func() {
+		if panicked {
+			p = recover()
+			// 此时尚未退栈，保存panic位置的调用栈供recovery输出
+			if _, ok := c.Get(recovery.StackKey); !ok {
+				c.Set(recovery.StackKey, debug.Stack())
+			}
+			c.Set(recovery.PanicKey, p)
+		}
+	}()
+	c.Next()
+	return nil, false
+}
+
+var levelRank = map[string]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+	LogLevelPanic: 4,
+	LogLevelFatal: 5,
+}
+
+// 根据响应状态以及执行时间确定日志级别：5xx为error，4xx以及慢请求为warn，不低于配置的级别lv
+func (util *hLogger) responseLevel(e *Exchange, lv string) string {
+	if util.FixedLevel {
+		return lv
+	}
+	ret := lv
+	switch {
+	case e.Status >= http.StatusInternalServerError:
+		ret = LogLevelError
+	case e.Status >= http.StatusBadRequest || e.Slow:
+		ret = LogLevelWarn
+	}
+	if levelRank[ret] < levelRank[lv] {
+		return lv
+	}
+	return ret
 }
 
-func (w *responseBodyWriter) Close() error {
-	return w.body.Close()
+func (util *hLogger) outputLevel(lv string, fmt string, args ...interface{}) {
+	switch lv {
+	case LogLevelDebug:
+		util.Logger.Debugf(fmt, args...)
+	case LogLevelInfo:
+		util.Logger.Infof(fmt, args...)
+	case LogLevelWarn:
+		util.Logger.Warnf(fmt, args...)
+	case LogLevelError:
+		util.Logger.Errorf(fmt, args...)
+	default:
+		util.output(fmt, args...)
+	}
 }
 
-func (w *responseBodyWriter) getBody() []byte {
-	return w.body.Bytes()
+func (util *hLogger) summarizeRequest(c *gin.Context, size int64) string {
+	if strings.HasPrefix(mediaType(c.GetHeader("Content-Type")), "multipart/") {
+		return summarizeMultipart(c.Request.MultipartForm, size)
+	}
+	return summarize(c.Request.Header, size)
 }
 
 func getHeaderBuffer(buf *bytes.Buffer, header http.Header) {
@@ -16,6 +16,11 @@
 
 package loghttp
 
+import (
+	"io"
+	"time"
+)
+
 func OptLogReqHeader(flag bool) LogOpt {
 	return func(setter Setter) {
 		setter.Set(LogReqHeaderKey, flag)
@@ -77,3 +82,86 @@ func OptLogLevel(lv string) LogOpt {
 		setter.Set(LogLevelKey, lv)
 	}
 }
+
+func OptLogFormat(format string) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogFormatKey, format)
+	}
+}
+
+// 使用自定义的Formatter
+func OptLogFormatter(f Formatter) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogFormatterKey, f)
+	}
+}
+
+// 设置日志脱敏，为nil时不脱敏
+func OptLogRedactor(r *Redactor) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogRedactorKey, r)
+	}
+}
+
+// 日志中输出的body的最大字节数，超出部分不输出
+func OptLogMaxBodySize(size int) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogMaxBodySizeKey, size)
+	}
+}
+
+// 设置按content type输出body的策略，为nil时输出所有body
+func OptLogBodyPolicy(p *BodyPolicy) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogBodyPolicyKey, p)
+	}
+}
+
+// 执行时间超过threshold的请求以warn级别输出，为0时不生效
+func OptLogSlowThreshold(threshold time.Duration) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogSlowThresholdKey, int(threshold/time.Millisecond))
+	}
+}
+
+// 为true时始终以配置的级别输出，不根据响应状态以及执行时间调整
+func OptLogFixedLevel(flag bool) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogFixedLevelKey, flag)
+	}
+}
+
+// 使用异步输出，多个HttpLogger可以共享同一个AsyncSink
+func OptLogAsync(sink *AsyncSink) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogAsyncSinkKey, sink)
+	}
+}
+
+// 设置运行时配置（参考Runtime），默认每个HttpLogger创建独立的Runtime
+func OptLogRuntime(rt *Runtime) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogRuntimeKey, rt)
+	}
+}
+
+// 日志直接输出到w（如RotateWriter），不使用Logger
+func OptLogWriter(w io.Writer) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogWriterKey, w)
+	}
+}
+
+// 按路由覆盖日志配置，优先级高于HttpLogger的配置
+func OptLogRoutes(routes ...RouteSetting) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogRoutesKey, routes)
+	}
+}
+
+// 添加Recorder，请求结束后接收脱敏后的记录，如HarFileRecorder、HarRing
+func OptLogRecorder(r Recorder) LogOpt {
+	return func(setter Setter) {
+		setter.Set(LogRecorderKey, r)
+	}
+}
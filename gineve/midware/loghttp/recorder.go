@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"sync"
+)
+
+const (
+	LogRecorderKey = "neve.web.log.recorder"
+)
+
+// 接收采集的请求/响应，用于导出（如HAR）或者查看最近的请求。
+// 每个请求结束后在请求的goroutine中调用，e为脱敏后的拷贝，多个Recorder共享，不能修改。
+// 采集的header、body与日志一致，受LogReqHeader、MaxBodySize等配置限制。
+type Recorder interface {
+	Record(e *Exchange)
+}
+
+// 获得HttpLogger的Recorder
+func GetRecorders(logger HttpLogger) []Recorder {
+	if v, ok := logger.(interface{ Recorders() []Recorder }); ok {
+		return v.Recorders()
+	}
+	return nil
+}
+
+// 保留最近的size条记录
+type exchangeRing struct {
+	lock  sync.Mutex
+	items []*Exchange
+	next  int
+	full  bool
+}
+
+func newExchangeRing(size int) *exchangeRing {
+	if size <= 0 {
+		size = 1
+	}
+	return &exchangeRing{
+		items: make([]*Exchange, size),
+	}
+}
+
+func (r *exchangeRing) add(e *Exchange) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.items[r.next] = e
+	r.next++
+	if r.next == len(r.items) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// 按时间顺序返回所有记录
+func (r *exchangeRing) list() []*Exchange {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return append([]*Exchange(nil), r.items[:r.next]...)
+	}
+	ret := make([]*Exchange, 0, len(r.items))
+	ret = append(ret, r.items[r.next:]...)
+	return append(ret, r.items[:r.next]...)
+}
+
+func (r *exchangeRing) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range r.items {
+		r.items[i] = nil
+	}
+	r.next = 0
+	r.full = false
+}
@@ -0,0 +1,322 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	LogRedactKey      = "neve.web.log.redact"
+	LogRedactorKey    = "neve.web.log.redactor"
+	DefaultRedactMask = "******"
+)
+
+// 未配置headers时默认脱敏的header
+var DefaultRedactHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "X-Auth-Token", "X-Access-Token", "X-Csrf-Token", "X-Xsrf-Token",
+}
+
+type redactConf struct {
+	// 关闭脱敏
+	Disable bool
+	// 需要脱敏的header名称
+	Headers []string
+	// 需要脱敏的body字段路径，不包含"."时匹配任意层级的同名字段，如password；
+	// 包含"."时从根开始匹配，如user.token（数组透明）。不包含"."的字段同时匹配同名的query参数
+	Fields []string
+	// 需要脱敏的正则表达式，作用于query、header值以及body
+	Patterns []string
+	// 替换的内容，默认为"******"
+	Mask string
+}
+
+// 日志脱敏，在日志格式化之前处理采集的header以及body，不影响实际的请求与响应。
+// nil Redactor不做任何处理。
+type Redactor struct {
+	mask     string
+	headers  map[string]bool
+	fields   [][]string
+	patterns []*regexp.Regexp
+	// 无法解析的json（如被截断）按字段名匹配
+	fieldPattern *regexp.Regexp
+}
+
+func NewRedactor(headers, fields, patterns []string, mask string) (*Redactor, error) {
+	if mask == "" {
+		mask = DefaultRedactMask
+	}
+	ret := &Redactor{
+		mask:    mask,
+		headers: map[string]bool{},
+	}
+	for _, h := range headers {
+		ret.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			ret.fields = append(ret.fields, strings.Split(f, "."))
+		}
+	}
+	if len(ret.fields) > 0 {
+		names := make([]string, 0, len(ret.fields))
+		for _, f := range ret.fields {
+			names = append(names, regexp.QuoteMeta(f[len(f)-1]))
+		}
+		ret.fieldPattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+	}
+	for _, p := range patterns {
+		reg, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("loghttp: invalid redact pattern %q: %v", p, err)
+		}
+		ret.patterns = append(ret.patterns, reg)
+	}
+	return ret, nil
+}
+
+// 仅对DefaultRedactHeaders脱敏
+func NewDefaultRedactor() *Redactor {
+	ret, _ := NewRedactor(DefaultRedactHeaders, nil, nil, "")
+	return ret
+}
+
+func redactorFromConfig(conf redactConf) (*Redactor, error) {
+	if conf.Disable {
+		return nil, nil
+	}
+	headers := conf.Headers
+	if len(headers) == 0 {
+		headers = DefaultRedactHeaders
+	}
+	return NewRedactor(headers, conf.Fields, conf.Patterns, conf.Mask)
+}
+
+// 处理请求的query、header以及body
+func (r *Redactor) RedactRequest(e *Exchange) {
+	if r == nil {
+		return
+	}
+	e.Query = r.RedactQuery(e.Query)
+	e.RequestHeader = r.RedactHeader(e.RequestHeader)
+	e.RequestBody = r.RedactBody(e.RequestContentType, e.RequestBody)
+}
+
+// 处理响应的header以及body
+func (r *Redactor) RedactResponse(e *Exchange) {
+	if r == nil {
+		return
+	}
+	e.ResponseHeader = r.RedactHeader(e.ResponseHeader)
+	e.ResponseBody = r.RedactBody(e.ResponseContentType, e.ResponseBody)
+	for i := range e.Errors {
+		e.Errors[i] = r.RedactString(e.Errors[i])
+	}
+	e.AbortReason = r.RedactString(e.AbortReason)
+	e.Panic = r.RedactString(e.Panic)
+}
+
+// 直接修改并返回header，调用者需要传入header的拷贝
+func (r *Redactor) RedactHeader(header http.Header) http.Header {
+	if r == nil || header == nil {
+		return header
+	}
+	for k, vs := range header {
+		if r.headers[k] {
+			for i := range vs {
+				vs[i] = r.mask
+			}
+			continue
+		}
+		for i := range vs {
+			vs[i] = r.RedactString(vs[i])
+		}
+	}
+	return header
+}
+
+// 按正则表达式替换
+func (r *Redactor) RedactString(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, reg := range r.patterns {
+		s = reg.ReplaceAllString(s, r.mask)
+	}
+	return s
+}
+
+// 按字段名以及正则表达式处理query
+func (r *Redactor) RedactQuery(query string) string {
+	if r == nil || query == "" {
+		return query
+	}
+	if len(r.fields) > 0 {
+		query = string(r.redactForm([]byte(query)))
+	}
+	return r.RedactString(query)
+}
+
+// 返回处理后的body，不修改原body
+func (r *Redactor) RedactBody(contentType string, body []byte) []byte {
+	if r == nil || len(body) == 0 {
+		return body
+	}
+	ret := body
+	if len(r.fields) > 0 {
+		ct := strings.ToLower(contentType)
+		if strings.Contains(ct, "json") || (ct == "" && looksLikeJson(body)) {
+			if b, err := r.redactJson(body); err == nil {
+				ret = b
+			} else {
+				ret = r.fieldPattern.ReplaceAll(body, []byte(`${1}"`+strings.ReplaceAll(r.mask, "$", "$$")+`"`))
+			}
+		} else if strings.HasPrefix(ct, gin.MIMEPOSTForm) {
+			ret = r.redactForm(body)
+		}
+	}
+	if len(r.patterns) > 0 {
+		s := string(ret)
+		ret = []byte(r.RedactString(s))
+	}
+	return ret
+}
+
+func looksLikeJson(body []byte) bool {
+	b := bytes.TrimSpace(body)
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[')
+}
+
+func (r *Redactor) matchField(path []string) bool {
+	for _, f := range r.fields {
+		if len(f) == 1 {
+			if len(path) > 0 && strings.EqualFold(path[len(path)-1], f[0]) {
+				return true
+			}
+			continue
+		}
+		if len(f) != len(path) {
+			continue
+		}
+		match := true
+		for i := range f {
+			if !strings.EqualFold(f[i], path[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// 按token重新输出json，保持字段顺序
+func (r *Redactor) redactJson(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	buf := bytes.NewBuffer(make([]byte, 0, len(body)))
+	if err := r.redactValue(dec, buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Redactor) redactValue(dec *json.Decoder, buf *bytes.Buffer, path []string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			buf.WriteByte('{')
+			for i := 0; dec.More(); i++ {
+				kt, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := kt.(string)
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				writeJsonString(buf, key)
+				buf.WriteByte(':')
+				sub := append(path[:len(path):len(path)], key)
+				if r.matchField(sub) {
+					var raw json.RawMessage
+					if err := dec.Decode(&raw); err != nil {
+						return err
+					}
+					writeJsonString(buf, r.mask)
+					continue
+				}
+				if err := r.redactValue(dec, buf, sub); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+		} else {
+			buf.WriteByte('[')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := r.redactValue(dec, buf, path); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		}
+		// 读取结束符
+		_, err = dec.Token()
+		return err
+	case string:
+		writeJsonString(buf, v)
+	case json.Number:
+		buf.WriteString(v.String())
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+func (r *Redactor) redactForm(body []byte) []byte {
+	pairs := strings.Split(string(body), "&")
+	for i, pair := range pairs {
+		key := pair
+		if n := strings.IndexByte(pair, '='); n >= 0 {
+			key = pair[:n]
+		}
+		if k, err := url.QueryUnescape(key); err == nil && r.matchField([]string{k}) {
+			pairs[i] = key + "=" + url.QueryEscape(r.mask)
+		}
+	}
+	return []byte(strings.Join(pairs, "&"))
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/xfali/xlog"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogFileKey   = "neve.web.log.file"
+	LogWriterKey = "neve.web.log.writer"
+
+	RotateDaily  = "daily"
+	RotateHourly = "hourly"
+
+	backupTimeLayout = "2006-01-02T15-04-05.000"
+)
+
+type fileConf struct {
+	// 日志文件路径，为空时不输出到文件
+	Path string
+	// 单个文件的最大大小（MB），0为不限制
+	MaxSize int
+	// 按时间切割：daily、hourly或者时间间隔（如"30m"），为空时不按时间切割
+	Rotate string
+	// 保留的备份文件数，0为不限制
+	MaxBackups int
+	// 备份文件保留的天数，0为不限制
+	MaxAge int
+	// 是否gzip压缩备份文件
+	Compress bool
+}
+
+type RotateOpt func(w *RotateWriter)
+
+// 按大小以及时间切割的日志文件，备份文件名为"name-2006-01-02T15-04-05.000.ext"
+type RotateWriter struct {
+	filename   string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	logger     xlog.Logger
+
+	lock   sync.Mutex
+	file   *os.File
+	size   int64
+	next   time.Time
+	closed bool
+
+	cleanLock sync.Mutex
+	wg        sync.WaitGroup
+}
+
+func NewRotateWriter(filename string, opts ...RotateOpt) (*RotateWriter, error) {
+	ret := &RotateWriter{
+		filename: filename,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if ret.logger == nil {
+		ret.logger = xlog.GetLogger()
+	}
+	if err := ret.open(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func checkFileConf(conf fileConf) error {
+	if conf.MaxSize < 0 || conf.MaxBackups < 0 || conf.MaxAge < 0 {
+		return fmt.Errorf("loghttp: %s maxSize, maxBackups and maxAge must not be negative", LogFileKey)
+	}
+	_, err := parseRotateInterval(conf.Rotate)
+	return err
+}
+
+func newRotateWriterFromConfig(conf fileConf, logger xlog.Logger) (*RotateWriter, error) {
+	interval, err := parseRotateInterval(conf.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	return NewRotateWriter(conf.Path,
+		OptRotateMaxSize(int64(conf.MaxSize)*1024*1024),
+		OptRotateInterval(interval),
+		OptRotateMaxBackups(conf.MaxBackups),
+		OptRotateMaxAge(time.Duration(conf.MaxAge)*24*time.Hour),
+		OptRotateCompress(conf.Compress),
+		OptRotateLogger(logger))
+}
+
+func parseRotateInterval(s string) (time.Duration, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return 0, nil
+	case RotateDaily:
+		return 24 * time.Hour, nil
+	case RotateHourly:
+		return time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("loghttp: invalid rotate interval %q: %v", s, err)
+	}
+	return d, nil
+}
+
+// 单个文件的最大字节数，0为不限制
+func OptRotateMaxSize(size int64) RotateOpt {
+	return func(w *RotateWriter) {
+		w.maxSize = size
+	}
+}
+
+// 按时间切割的间隔，24h按本地时间的0点切割，0为不按时间切割
+func OptRotateInterval(d time.Duration) RotateOpt {
+	return func(w *RotateWriter) {
+		w.interval = d
+	}
+}
+
+// 保留的备份文件数，0为不限制
+func OptRotateMaxBackups(n int) RotateOpt {
+	return func(w *RotateWriter) {
+		w.maxBackups = n
+	}
+}
+
+// 备份文件保留的时间，0为不限制
+func OptRotateMaxAge(d time.Duration) RotateOpt {
+	return func(w *RotateWriter) {
+		w.maxAge = d
+	}
+}
+
+func OptRotateCompress(flag bool) RotateOpt {
+	return func(w *RotateWriter) {
+		w.compress = flag
+	}
+}
+
+// 输出压缩失败等后台错误的日志对象，默认为xlog.GetLogger()
+func OptRotateLogger(logger xlog.Logger) RotateOpt {
+	return func(w *RotateWriter) {
+		w.logger = logger
+	}
+}
+
+// Close之后返回os.ErrClosed
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if (w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize) ||
+		(!w.next.IsZero() && !time.Now().Before(w.next)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.next = w.nextRotateTime(time.Now())
+	return nil
+}
+
+func (w *RotateWriter) nextRotateTime(now time.Time) time.Time {
+	if w.interval <= 0 {
+		return time.Time{}
+	}
+	if w.interval == 24*time.Hour {
+		y, m, d := now.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+	return now.Truncate(w.interval).Add(w.interval)
+}
+
+func (w *RotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	backup := backupName(w.filename, time.Now())
+	if err := os.Rename(w.filename, backup); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.cleanup(backup)
+	}()
+	return nil
+}
+
+// 备份文件名为"name-2006-01-02T15-04-05.000.ext"
+func backupName(filename string, t time.Time) string {
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filename, ext) + "-" + t.Format(backupTimeLayout)
+	name := prefix + ext
+	// 同一时间多次切割时增加序号
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d%s", prefix, i, ext)
+	}
+	return name
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// 压缩新的备份文件并按数量以及时间清理备份文件
+func (w *RotateWriter) cleanup(backup string) {
+	w.cleanLock.Lock()
+	defer w.cleanLock.Unlock()
+
+	if w.compress {
+		if err := gzipFile(backup); err != nil {
+			w.logger.Errorf("loghttp: compress %s failed: %v\n", backup, err)
+		}
+	}
+	cleanupBackups(w.filename, w.maxBackups, w.maxAge)
+}
+
+// 按数量以及时间清理filename的备份文件
+func cleanupBackups(filename string, maxBackups int, maxAge time.Duration) {
+	if maxBackups <= 0 && maxAge <= 0 {
+		return
+	}
+	dir := filepath.Dir(filename)
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filepath.Base(filename), ext) + "-"
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var backups []backupFile
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		if b, ok := parseBackup(info, prefix, ext); ok {
+			backups = append(backups, b)
+		}
+	}
+	// 按备份时间以及序号从新到旧
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].time.Equal(backups[j].time) {
+			return backups[i].time.After(backups[j].time)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	deadline := time.Now().Add(-maxAge)
+	for i, b := range backups {
+		if (maxBackups > 0 && i >= maxBackups) || (maxAge > 0 && b.info.ModTime().Before(deadline)) {
+			os.Remove(filepath.Join(dir, b.info.Name()))
+		}
+	}
+}
+
+type backupFile struct {
+	info os.FileInfo
+	time time.Time
+	seq  int
+}
+
+// 仅匹配backupName生成的文件：<prefix><backupTimeLayout>[.序号]<ext>[.gz]，避免删除其他同前缀的文件
+func parseBackup(info os.FileInfo, prefix, ext string) (backupFile, bool) {
+	ret := backupFile{info: info}
+	name := strings.TrimSuffix(info.Name(), ".gz")
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) || len(name) < len(prefix)+len(ext) {
+		return ret, false
+	}
+	stamp := name[len(prefix) : len(name)-len(ext)]
+	if len(stamp) < len(backupTimeLayout) {
+		return ret, false
+	}
+	t, err := time.ParseInLocation(backupTimeLayout, stamp[:len(backupTimeLayout)], time.Local)
+	if err != nil {
+		return ret, false
+	}
+	ret.time = t
+	seq := stamp[len(backupTimeLayout):]
+	if seq == "" {
+		return ret, true
+	}
+	if !strings.HasPrefix(seq, ".") {
+		return ret, false
+	}
+	ret.seq, err = strconv.Atoi(seq[1:])
+	return ret, err == nil && ret.seq > 0
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	if _, err = io.Copy(gw, src); err == nil {
+		err = gw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+// 关闭文件并等待备份文件的压缩以及清理完成
+func (w *RotateWriter) Close() error {
+	w.lock.Lock()
+	var err error
+	w.closed = true
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.lock.Unlock()
+	w.wg.Wait()
+	return err
+}
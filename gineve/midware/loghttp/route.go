@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+const (
+	LogRoutesKey = "neve.web.log.routes"
+)
+
+// 按路由覆盖日志配置，未配置（nil或者空）的项使用HttpLogger的配置
+type RouteSetting struct {
+	// 匹配规则，参考RouteMatcher，如"POST /upload"
+	Path           string `json:"path"`
+	RequestHeader  *bool  `json:"requestHeader,omitempty"`
+	RequestBody    *bool  `json:"requestBody,omitempty"`
+	ResponseHeader *bool  `json:"responseHeader,omitempty"`
+	ResponseBody   *bool  `json:"responseBody,omitempty"`
+	Level          string `json:"level,omitempty"`
+}
+
+type routeSetting struct {
+	matcher *RouteMatcher
+	setting RouteSetting
+}
+
+func compileRouteSettings(settings []RouteSetting) ([]routeSetting, error) {
+	var ret []routeSetting
+	for _, s := range settings {
+		m, err := NewRouteMatcher(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, routeSetting{matcher: m, setting: s})
+	}
+	return ret, nil
+}
+
+// 请求生效的日志配置
+type logSettings struct {
+	reqHeader  bool
+	reqBody    bool
+	respHeader bool
+	respBody   bool
+	level      string
+}
+
+func (s *logSettings) apply(rs RouteSetting) {
+	if rs.RequestHeader != nil {
+		s.reqHeader = *rs.RequestHeader
+	}
+	if rs.RequestBody != nil {
+		s.reqBody = *rs.RequestBody
+	}
+	if rs.ResponseHeader != nil {
+		s.respHeader = *rs.ResponseHeader
+	}
+	if rs.ResponseBody != nil {
+		s.respBody = *rs.ResponseBody
+	}
+	if rs.Level != "" {
+		s.level = normalizeLevel(rs.Level)
+	}
+}
+
+// 依次按第一条匹配的路由配置、运行时配置覆盖
+func (util *hLogger) settings(c *gin.Context) logSettings {
+	ret := logSettings{
+		reqHeader:  util.LogReqHeader,
+		reqBody:    util.LogReqBody,
+		respHeader: util.LogRespHeader,
+		respBody:   util.LogRespBody,
+		level:      normalizeLevel(util.Level),
+	}
+	for _, r := range util.routes {
+		if r.matcher.MatchContext(c) {
+			ret.apply(r.setting)
+			break
+		}
+	}
+	if util.runtime != nil {
+		util.runtime.apply(&ret, c)
+	}
+	return ret
+}
+
+func normalizeLevel(lv string) string {
+	lv = strings.ToLower(lv)
+	if _, ok := levelRank[lv]; !ok {
+		return LogLevelInfo
+	}
+	return lv
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loghttp
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LogRuntimeKey = "neve.web.log.runtime"
+)
+
+// 运行时的日志配置，优先级高于HttpLogger以及neve.web.log.routes的配置
+type RuntimeSetting struct {
+	RequestHeader  *bool  `json:"requestHeader,omitempty"`
+	RequestBody    *bool  `json:"requestBody,omitempty"`
+	ResponseHeader *bool  `json:"responseHeader,omitempty"`
+	ResponseBody   *bool  `json:"responseBody,omitempty"`
+	Level          string `json:"level,omitempty"`
+	// 按路由覆盖，优先级高于上述全局配置
+	Routes []RouteSetting `json:"routes,omitempty"`
+}
+
+type runtimeState struct {
+	setting RuntimeSetting
+	routes  []routeSetting
+	expire  time.Time
+	version uint64
+}
+
+// 在运行时修改日志配置，无需重新创建handler，修改原子生效。
+// 同一个HttpLogger以及其Clone的HttpLogger共享同一个Runtime。
+type Runtime struct {
+	lock    sync.Mutex
+	state   atomic.Value
+	version uint64
+	// ttl到期后执行恢复
+	afterFunc func(d time.Duration, f func())
+}
+
+type RuntimeOpt func(r *Runtime)
+
+func NewRuntime(opts ...RuntimeOpt) *Runtime {
+	ret := &Runtime{
+		afterFunc: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	ret.state.Store(&runtimeState{})
+	return ret
+}
+
+// 设置ttl到期后执行恢复的定时器，默认为time.AfterFunc，可用于测试中直接触发恢复
+func OptRuntimeAfterFunc(f func(d time.Duration, f func())) RuntimeOpt {
+	return func(r *Runtime) {
+		if f != nil {
+			r.afterFunc = f
+		}
+	}
+}
+
+// 获得HttpLogger的Runtime，不支持时返回nil
+func GetRuntime(logger HttpLogger) *Runtime {
+	if v, ok := logger.(interface{ Runtime() *Runtime }); ok {
+		return v.Runtime()
+	}
+	return nil
+}
+
+func (r *Runtime) load() *runtimeState {
+	return r.state.Load().(*runtimeState)
+}
+
+// 替换运行时配置，ttl大于0时在ttl后恢复为之前的配置
+func (r *Runtime) Set(setting RuntimeSetting, ttl time.Duration) error {
+	if err := checkLevel(setting.Level); err != nil {
+		return err
+	}
+	for _, rs := range setting.Routes {
+		if err := checkLevel(rs.Level); err != nil {
+			return err
+		}
+	}
+	routes, err := compileRouteSettings(setting.Routes)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	prev := r.load()
+	r.version++
+	st := &runtimeState{
+		setting: setting,
+		routes:  routes,
+		version: r.version,
+	}
+	if ttl > 0 {
+		st.expire = time.Now().Add(ttl)
+		r.afterFunc(ttl, func() {
+			r.revert(st.version, prev)
+		})
+	}
+	r.state.Store(st)
+	return nil
+}
+
+func (r *Runtime) revert(version uint64, prev *runtimeState) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// 已被再次修改
+	if r.load().version != version {
+		return
+	}
+	if !prev.expire.IsZero() && !time.Now().Before(prev.expire) {
+		prev = &runtimeState{}
+	}
+	r.state.Store(prev)
+}
+
+// 清除运行时配置
+func (r *Runtime) Reset() {
+	_ = r.Set(RuntimeSetting{}, 0)
+}
+
+// 获得当前的运行时配置以及过期时间（未设置ttl时为零值）
+func (r *Runtime) Get() (RuntimeSetting, time.Time) {
+	st := r.load()
+	return st.setting, st.expire
+}
+
+func (r *Runtime) apply(s *logSettings, c *gin.Context) {
+	st := r.load()
+	s.apply(RouteSetting{
+		RequestHeader:  st.setting.RequestHeader,
+		RequestBody:    st.setting.RequestBody,
+		ResponseHeader: st.setting.ResponseHeader,
+		ResponseBody:   st.setting.ResponseBody,
+		Level:          st.setting.Level,
+	})
+	for _, rs := range st.routes {
+		if rs.matcher.MatchContext(c) {
+			s.apply(rs.setting)
+			break
+		}
+	}
+}
+
+func checkLevel(lv string) error {
+	if lv == "" {
+		return nil
+	}
+	if _, ok := levelRank[strings.ToLower(lv)]; !ok {
+		return fmt.Errorf("loghttp: invalid level %q", lv)
+	}
+	return nil
+}
+
+type runtimeView struct {
+	Setting RuntimeSetting `json:"setting"`
+	Expire  *time.Time     `json:"expire,omitempty"`
+}
+
+// 管理接口：
+// GET /loghttp 获得当前的运行时配置；
+// PUT /loghttp?ttl=5m 替换运行时配置，body为RuntimeSetting的json；
+// DELETE /loghttp 清除运行时配置。
+func (r *Runtime) AdminRoutes(router gin.IRouter) {
+	router.GET("/loghttp", r.getHandler)
+	router.PUT("/loghttp", r.setHandler)
+	router.DELETE("/loghttp", r.resetHandler)
+}
+
+func (r *Runtime) getHandler(ctx *gin.Context) {
+	setting, expire := r.Get()
+	view := runtimeView{Setting: setting}
+	if !expire.IsZero() {
+		view.Expire = &expire
+	}
+	ret := result.Ok(view)
+	ret.WriteJson(ctx)
+}
+
+func (r *Runtime) setHandler(ctx *gin.Context) {
+	var ttl time.Duration
+	if v := ctx.Query("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			result.BadRequestError.Clone().SetMessage(err.Error()).WriteJson(ctx)
+			return
+		}
+		ttl = d
+	}
+	setting := RuntimeSetting{}
+	if err := ctx.ShouldBindJSON(&setting); err != nil {
+		result.BadRequestError.Clone().SetMessage(err.Error()).WriteJson(ctx)
+		return
+	}
+	if err := r.Set(setting, ttl); err != nil {
+		result.BadRequestError.Clone().SetMessage(err.Error()).WriteJson(ctx)
+		return
+	}
+	r.getHandler(ctx)
+}
+
+func (r *Runtime) resetHandler(ctx *gin.Context) {
+	r.Reset()
+	r.getHandler(ctx)
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultPath = "/metrics"
+
+	// Prometheus text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// 未匹配到路由的请求使用的route标签，避免按原始path产生大量的时间序列
+	UnmatchedRoute = "unmatched"
+	// 非标准的HTTP方法使用的method标签，避免任意的method产生大量的时间序列
+	OtherMethod = "other"
+)
+
+var (
+	// 请求耗时的buckets（秒）
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// 请求、响应大小的buckets（字节）
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+type Opt func(m *Metrics)
+
+// 记录HTTP请求的指标，按method、route（路由模板）、status（状态码类别，如2xx）分组：
+//
+//	http_requests_total                 请求数
+//	http_request_duration_seconds       请求耗时
+//	http_request_size_bytes             请求大小
+//	http_response_size_bytes            响应大小
+//	http_requests_in_flight             正在处理的请求数
+type Metrics struct {
+	path        string
+	buckets     []float64
+	sizeBuckets []float64
+
+	inFlight int64
+
+	lock   sync.Mutex
+	series map[seriesKey]*series
+}
+
+type seriesKey struct {
+	method string
+	route  string
+	status string
+}
+
+type series struct {
+	count    uint64
+	latency  *histogram
+	reqSize  *histogram
+	respSize *histogram
+}
+
+type histogram struct {
+	buckets []float64
+	// 每个bucket的计数（非累积），最后一个为+Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics(opts ...Opt) *Metrics {
+	ret := &Metrics{
+		path:        DefaultPath,
+		buckets:     DefaultBuckets,
+		sizeBuckets: DefaultSizeBuckets,
+		series:      map[seriesKey]*series{},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// 设置指标的访问路径，默认为/metrics
+func OptPath(path string) Opt {
+	return func(m *Metrics) {
+		if path != "" {
+			m.path = "/" + strings.TrimLeft(path, "/")
+		}
+	}
+}
+
+// 设置请求耗时的buckets（秒），为空时使用DefaultBuckets
+func OptBuckets(buckets ...float64) Opt {
+	return func(m *Metrics) {
+		if len(buckets) > 0 {
+			m.buckets = normalizeBuckets(buckets)
+		}
+	}
+}
+
+// 设置请求、响应大小的buckets（字节），为空时使用DefaultSizeBuckets
+func OptSizeBuckets(buckets ...float64) Opt {
+	return func(m *Metrics) {
+		if len(buckets) > 0 {
+			m.sizeBuckets = normalizeBuckets(buckets)
+		}
+	}
+}
+
+// 排序并去除重复以及+Inf（总是存在）
+func normalizeBuckets(buckets []float64) []float64 {
+	ret := append([]float64{}, buckets...)
+	sort.Float64s(ret)
+	n := 0
+	for i, v := range ret {
+		if math.IsInf(v, 1) || math.IsNaN(v) || (i > 0 && v == ret[i-1]) {
+			continue
+		}
+		ret[n] = v
+		n++
+	}
+	return ret[:n]
+}
+
+func (m *Metrics) Path() string {
+	return m.path
+}
+
+// 采集指标的中间件，可以在recovery之前或之后注册：panic的请求在继续panic之前按500记录（已写出响应时按写出的状态码），
+// 因此不依赖recovery写出的响应
+func (m *Metrics) Collect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		atomic.AddInt64(&m.inFlight, 1)
+		defer func() {
+			atomic.AddInt64(&m.inFlight, -1)
+			status := c.Writer.Status()
+			if p := recover(); p != nil {
+				if !c.Writer.Written() {
+					status = http.StatusInternalServerError
+				}
+				m.observe(c, status, start)
+				panic(p)
+			}
+			m.observe(c, status, start)
+		}()
+		c.Next()
+	}
+}
+
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return OtherMethod
+}
+
+func (m *Metrics) observe(c *gin.Context, status int, start time.Time) {
+	route := c.FullPath()
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	key := seriesKey{
+		method: methodLabel(c.Request.Method),
+		route:  route,
+		status: statusClass(status),
+	}
+	reqSize := c.Request.ContentLength
+	if reqSize < 0 {
+		reqSize = 0
+	}
+	respSize := c.Writer.Size()
+	if respSize < 0 {
+		respSize = 0
+	}
+	latency := time.Since(start).Seconds()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{
+			latency:  newHistogram(m.buckets),
+			reqSize:  newHistogram(m.sizeBuckets),
+			respSize: newHistogram(m.sizeBuckets),
+		}
+		m.series[key] = s
+	}
+	s.count++
+	s.latency.observe(latency)
+	s.reqSize.observe(float64(reqSize))
+	s.respSize.observe(float64(respSize))
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	// 第一个大于等于v的bucket
+	h.counts[sort.SearchFloat64s(h.buckets, v)]++
+	h.sum += v
+	h.count++
+}
+
+// 输出指标的handler
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", ContentType)
+		c.Status(http.StatusOK)
+		if err := m.Write(c.Writer); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// 在管理接口下注册指标的访问路径
+func (m *Metrics) AdminRoutes(router gin.IRouter) {
+	router.GET(m.path, m.Handler())
+}
+
+type snapshot struct {
+	key seriesKey
+	series
+}
+
+func (m *Metrics) snapshot() []snapshot {
+	m.lock.Lock()
+	ret := make([]snapshot, 0, len(m.series))
+	for k, s := range m.series {
+		ret = append(ret, snapshot{
+			key: k,
+			series: series{
+				count:    s.count,
+				latency:  s.latency.clone(),
+				reqSize:  s.reqSize.clone(),
+				respSize: s.respSize.clone(),
+			},
+		})
+	}
+	m.lock.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i].key, ret[j].key
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	return ret
+}
+
+func (h *histogram) clone() *histogram {
+	ret := *h
+	ret.counts = append([]uint64{}, h.counts...)
+	return &ret
+}
+
+// 按Prometheus text exposition format输出所有指标
+func (m *Metrics) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	list := m.snapshot()
+
+	writeHeader(bw, "http_requests_total", "counter", "Total number of HTTP requests.")
+	for _, s := range list {
+		fmt.Fprintf(bw, "http_requests_total{%s} %d\n", s.key.labels(), s.count)
+	}
+	writeHistograms(bw, "http_request_duration_seconds", "HTTP request latency in seconds.", list, func(s *series) *histogram {
+		return s.latency
+	})
+	writeHistograms(bw, "http_request_size_bytes", "HTTP request size in bytes.", list, func(s *series) *histogram {
+		return s.reqSize
+	})
+	writeHistograms(bw, "http_response_size_bytes", "HTTP response size in bytes.", list, func(s *series) *histogram {
+		return s.respSize
+	})
+	writeHeader(bw, "http_requests_in_flight", "gauge", "Number of HTTP requests currently being served.")
+	fmt.Fprintf(bw, "http_requests_in_flight %d\n", atomic.LoadInt64(&m.inFlight))
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistograms(w io.Writer, name, help string, list []snapshot, get func(s *series) *histogram) {
+	writeHeader(w, name, "histogram", help)
+	for i := range list {
+		labels := list[i].key.labels()
+		h := get(&list[i].series)
+		var cumulative uint64
+		for j, le := range h.buckets {
+			cumulative += h.counts[j]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func (k seriesKey) labels() string {
+	return fmt.Sprintf(`method="%s",route="%s",status="%s"`, escapeLabel(k.method), escapeLabel(k.route), escapeLabel(k.status))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
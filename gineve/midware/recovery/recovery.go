@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/gineve/midware/requestid"
 	"github.com/xfali/xlog"
 	"io/ioutil"
 	"net"
@@ -29,6 +30,14 @@ import (
 	"strings"
 )
 
+const (
+	// panic的值，日志等中间件可以通过该key获得
+	PanicKey = "_NEVE_PANIC"
+	// panic位置的调用栈，在recovery之前捕获panic的中间件可以设置，
+	// 重新panic后recovery获得的调用栈不再包含panic的位置
+	StackKey = "_NEVE_PANIC_STACK"
+)
+
 type PanicHandler func(ctx *gin.Context, err interface{})
 
 type RecoveryUtil struct {
@@ -55,12 +64,19 @@ func (u *RecoveryUtil) handle(c *gin.Context) {
 				}
 			}
 		}
-		stack := stack(3)
+		var stack []byte
+		if v, ok := c.Get(StackKey); ok {
+			stack, _ = v.([]byte)
+		}
+		if stack == nil {
+			stack = stackTrace(3)
+		}
+		c.Set(PanicKey, err)
 		httpRequest, _ := httputil.DumpRequest(c.Request, false)
 		if brokenPipe {
 			u.Logger.Infof("%s\n%s", err, string(httpRequest))
 		}
-		u.Logger.Infof("[Recovery] panic recovered:\n%s\n%s\n", err, stack)
+		u.Logger.Infof("[Recovery %s] panic recovered:\n%s\n%s\n", requestid.Get(c), err, stack)
 
 		// If the connection is dead, we can't write a status to it.
 		if brokenPipe {
@@ -79,8 +95,8 @@ var (
 	slash     = []byte("/")
 )
 
-// stack returns a nicely formatted stack frame, skipping skip frames.
-func stack(skip int) []byte {
+// stackTrace returns a nicely formatted stack frame, skipping skip frames.
+func stackTrace(skip int) []byte {
 	buf := new(bytes.Buffer) // the returned data
 	// As we loop, we open files and read them. These variables record the currently
 	// loaded file.
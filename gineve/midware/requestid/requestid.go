@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/goutils/idUtil"
+	"github.com/xfali/neve-web/ctxkey"
+	"strings"
+	"time"
+)
+
+const (
+	// 与loghttp.REQEUST_ID保持一致
+	Key = ctxkey.RequestId
+
+	DefaultHeader = "X-Request-ID"
+
+	// 当前请求使用的Generator，GetOrCreate使用该Generator生成ID
+	GeneratorKey = "_NEVE_REQUEST_ID_GENERATOR"
+
+	GeneratorUUID   = "uuid"
+	GeneratorULID   = "ulid"
+	GeneratorRandom = "random"
+
+	// 请求携带的ID超过该长度时重新生成
+	maxIdLength = 128
+)
+
+type ctxKey struct{}
+
+type Generator func() string
+
+type RequestIdUtil struct {
+	// 读取以及回写请求ID的header，为空则使用X-Request-ID
+	Header    string
+	Generator Generator
+}
+
+// 优先使用请求header中的ID，不存在则生成新的ID。
+// ID保存在gin.Context以及request的context.Context中，并在响应header中返回。
+func (u *RequestIdUtil) RequestId() gin.HandlerFunc {
+	header := u.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+	gen := u.Generator
+	if gen == nil {
+		gen = UUID
+	}
+	return func(c *gin.Context) {
+		c.Set(GeneratorKey, gen)
+		id := c.GetHeader(header)
+		if !valid(id) {
+			id = gen()
+		}
+		Set(c, id)
+		c.Header(header, id)
+		c.Next()
+	}
+}
+
+// 获得当前请求的ID，不存在时返回空字符串
+func Get(c *gin.Context) string {
+	return c.GetString(Key)
+}
+
+// 设置当前请求的ID，同时保存在request的context.Context中
+func Set(c *gin.Context, id string) {
+	c.Set(Key, id)
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(WithContext(c.Request.Context(), id))
+	}
+}
+
+// 获得当前请求的ID，不存在时使用当前请求的Generator（参考GeneratorHandler）生成新的ID并保存
+func GetOrCreate(c *gin.Context) string {
+	id := Get(c)
+	if id == "" {
+		id = getGenerator(c)()
+		Set(c, id)
+	}
+	return id
+}
+
+// 在请求中设置Generator，未使用RequestId中间件时GetOrCreate同样使用配置的Generator
+func GeneratorHandler(gen Generator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if gen != nil {
+			c.Set(GeneratorKey, gen)
+		}
+	}
+}
+
+// 获得请求中设置的Generator，未设置时返回UUID
+func getGenerator(c *gin.Context) Generator {
+	if v, ok := c.Get(GeneratorKey); ok {
+		if gen, ok := v.(Generator); ok && gen != nil {
+			return gen
+		}
+	}
+	return UUID
+}
+
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(ctxKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// 根据名称获得内置的Generator：uuid、ulid、random，名称为空时返回UUID，名称不存在时返回错误
+func GetGenerator(name string) (Generator, error) {
+	switch strings.ToLower(name) {
+	case "", GeneratorUUID:
+		return UUID, nil
+	case GeneratorULID:
+		return ULID, nil
+	case GeneratorRandom:
+		return Random, nil
+	}
+	return nil, fmt.Errorf("requestid: unknown generator %q, expect one of %s, %s, %s",
+		name, GeneratorUUID, GeneratorULID, GeneratorRandom)
+}
+
+// UUID v4
+func UUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	buf := make([]byte, 36)
+	hex.Encode(buf, b[:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf)
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID：48位毫秒时间戳 + 80位随机数，Crockford base32编码，可按时间排序
+func ULID() string {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	_, _ = rand.Read(b[6:])
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	buf := make([]byte, 26)
+	// 128位按5位一组编码，最高位组只有3位
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf)
+}
+
+func Random() string {
+	return idUtil.RandomId(16)
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
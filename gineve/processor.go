@@ -17,14 +17,21 @@
 package gineve
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/xfali/fig"
 	"github.com/xfali/neve-core/bean"
+	"github.com/xfali/neve-web/ctxkey"
+	"github.com/xfali/neve-web/gineve/midware/jsonpolicy"
 	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"github.com/xfali/neve-web/gineve/midware/metrics"
 	"github.com/xfali/neve-web/gineve/midware/recovery"
+	"github.com/xfali/neve-web/gineve/midware/requestid"
 	"github.com/xfali/neve-web/result"
 	"github.com/xfali/xlog"
+	"io"
 	"net/http"
 	"time"
 )
@@ -53,20 +60,81 @@ type tlsConf struct {
 	Key  string
 }
 
+type adminConf struct {
+	Enable bool
+	// 管理接口的根路径，默认为/admin
+	Path string
+	Host string
+	// 为0时使用WEB服务的端口
+	Port int
+	// 不为空时，访问管理接口需要携带token，参考AdminTokenAuth
+	Token string
+	// port为0时管理接口挂载在WEB服务的端口上，未设置token以及OptAddAdminFilters时需要显式设置为true
+	Public bool
+}
+
+type metricsConf struct {
+	Enable bool
+	// 指标的访问路径，默认为/metrics
+	Path string
+	// 为true时在管理接口下提供，否则使用WEB服务的端口（不包含contextPath）
+	Admin bool
+	// 请求耗时的buckets（秒）
+	Buckets []float64
+	// 请求、响应大小的buckets（字节）
+	SizeBuckets []float64
+}
+
+type requestIdConf struct {
+	Disable   bool
+	Header    string
+	Generator string
+	// result.Result输出时是否包含requestId字段
+	Response bool
+}
+
+type jsonConf struct {
+	Int64AsString bool
+	EscapeHTML    *bool
+	// 无法对ctx.JSON的输出生效，已不支持，配置时启动失败
+	TimeLayout      string
+	NilSliceAsEmpty bool
+}
+
 type Processor struct {
-	conf   fig.Properties
-	logger xlog.Logger
-	server *http.Server
+	conf        fig.Properties
+	logger      xlog.Logger
+	server      *http.Server
+	adminServer *http.Server
 
-	compList []Component
+	compList  []Component
+	adminList []AdminComponent
 
 	filters gin.HandlersChain
+	// 仅作用于管理接口
+	adminFilters gin.HandlersChain
 
 	panicHandler recovery.PanicHandler
 	httpLogger   loghttp.HttpLogger
 
 	srvModifier ServerModifier
 	logAll      bool
+	logFilter   *loghttp.LogFilter
+	// 为nil时使用neve.web.log.bindBody配置
+	bindLogRoutes []string
+	// 设置RequestBodyLogWriter之前的binding.Validator，BeanDestroy时恢复
+	originValidator binding.StructValidator
+	bindLogWriter   *loghttp.RequestBodyLogWriter
+
+	jsonPolicy  *result.JsonPolicy
+	jsonEncoder result.JsonEncoder
+
+	requestIdGen requestid.Generator
+	// 按neve.web.query配置创建，仅作用于当前Processor的请求
+	queryParser *QueryParser
+
+	metrics      *metrics.Metrics
+	metricsAdmin bool
 }
 
 type ServerModifier func(srv *http.Server, engine *gin.Engine)
@@ -88,21 +156,102 @@ func NewProcessor(opts ...Opt) *Processor {
 
 func (p *Processor) Init(conf fig.Properties, container bean.Container) error {
 	p.conf = conf
+	var err error
+	p.queryParser, err = NewQueryParserFromConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	err = p.initJsonEncoder(conf)
+	if err != nil {
+		return err
+	}
+
+	err = p.initRequestId(conf)
+	if err != nil {
+		return err
+	}
+
 	if p.httpLogger == nil {
-		p.httpLogger = loghttp.NewFromConfig(conf, p.logger)
+		hl, err := loghttp.NewFromConfig(conf, p.logger)
+		if err != nil {
+			return err
+		}
+		p.httpLogger = hl
+	}
+	if p.logFilter == nil {
+		p.logFilter, err = loghttp.NewLogFilterFromConfig(conf)
+		if err != nil {
+			return err
+		}
+	}
+	err = p.initBindLog(conf)
+	if err != nil {
+		return err
 	}
 	container.Register(p.httpLogger)
 	return nil
 }
 
+// 在Init阶段校验neve.web.requestId.generator，名称错误时返回错误而不是使用默认的生成器
+func (p *Processor) initRequestId(conf fig.Properties) error {
+	if p.requestIdGen != nil {
+		return nil
+	}
+	ridConf := requestIdConf{}
+	err := conf.GetValue("neve.web.requestId", &ridConf)
+	if err != nil {
+		return err
+	}
+	p.requestIdGen, err = requestid.GetGenerator(ridConf.Generator)
+	return err
+}
+
+func (p *Processor) initBindLog(conf fig.Properties) error {
+	var w *loghttp.RequestBodyLogWriter
+	var err error
+	redactor := loghttp.GetRedactor(p.httpLogger)
+	if p.bindLogRoutes != nil {
+		w, err = loghttp.NewRequestBodyLogWriter(p.logger, binding.Validator, redactor, p.bindLogRoutes...)
+		if err == nil {
+			w.Level, err = loghttp.BindLogLevelFromConfig(conf)
+		}
+	} else {
+		w, err = loghttp.NewRequestBodyLogWriterFromConfig(conf, p.logger, binding.Validator, redactor)
+	}
+	if err != nil {
+		return err
+	}
+	// binding.Validator为gin的全局变量，同一进程中的其他engine同样生效，BeanDestroy时恢复
+	if w != nil {
+		p.originValidator = binding.Validator
+		p.bindLogWriter = w
+		binding.Validator = w
+	}
+	return nil
+}
+
 func (p *Processor) Classify(o interface{}) (bool, error) {
+	// 管理接口可以与其他接口同时实现
+	admin := false
+	if v, ok := o.(AdminComponent); ok {
+		p.adminList = append(p.adminList, v)
+		admin = true
+	}
 	switch v := o.(type) {
 	case Component:
 		return true, p.parseBean(v)
+	case Controller:
+		return true, p.parseController(v)
+	case Resource:
+		return true, p.parseResource(v)
 	case Filter:
 		return true, p.parseFilter(v)
 	}
-	return false, nil
+	if hasRouteTags(o) {
+		return true, p.parseController(o)
+	}
+	return admin, nil
 }
 
 func (p *Processor) Process() error {
@@ -110,10 +259,25 @@ func (p *Processor) Process() error {
 }
 
 func (p *Processor) BeanDestroy() error {
+	var err error
 	if p.server != nil {
-		return p.server.Close()
+		err = p.server.Close()
 	}
-	return nil
+	if p.adminServer != nil {
+		if cerr := p.adminServer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if p.bindLogWriter != nil && binding.Validator == p.bindLogWriter {
+		binding.Validator = p.originValidator
+	}
+	// 输出异步日志队列中的日志
+	if c, ok := p.httpLogger.(io.Closer); ok {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
 func (p *Processor) start(conf fig.Properties) error {
@@ -121,6 +285,38 @@ func (p *Processor) start(conf fig.Properties) error {
 	//r.Use(gin.Logger())
 	//r.Use(gin.Recovery())
 
+	// WriteResult等使用Processor的logger
+	r.Use(func(ctx *gin.Context) {
+		ctx.Set(ctxkey.Logger, p.logger)
+	})
+	if p.queryParser != nil {
+		r.Use(QueryParserHandler(p.queryParser))
+	}
+
+	err := p.initMetrics(conf)
+	if err != nil {
+		return err
+	}
+
+	ridConf := requestIdConf{}
+	err = conf.GetValue("neve.web.requestId", &ridConf)
+	if err != nil {
+		return err
+	}
+	if !ridConf.Disable {
+		ridU := &requestid.RequestIdUtil{
+			Header:    ridConf.Header,
+			Generator: p.requestIdGen,
+		}
+		r.Use(ridU.RequestId())
+	} else {
+		// loghttp等通过requestid.GetOrCreate生成的ID同样使用配置的Generator
+		r.Use(requestid.GeneratorHandler(p.requestIdGen))
+	}
+	if ridConf.Response {
+		r.Use(result.EnableRequestId)
+	}
+
 	if p.panicHandler != nil {
 		panicU := &recovery.RecoveryUtil{
 			Logger:       p.logger,
@@ -128,8 +324,18 @@ func (p *Processor) start(conf fig.Properties) error {
 		}
 		r.Use(panicU.Recovery())
 	}
+	if p.metrics != nil {
+		// 在recovery之后采集，panic的请求在继续panic之前按500记录
+		r.Use(p.metrics.Collect())
+		if !p.metricsAdmin {
+			r.GET(p.metrics.Path(), p.metrics.Handler())
+		}
+	}
 	if p.logAll {
-		r.Use(p.httpLogger.LogHttp())
+		r.Use(p.logFilter.Wrap(p.httpLogger.LogHttp()))
+	}
+	if re, ok := p.jsonEncoder.(result.JsonReencoder); ok {
+		r.Use(jsonpolicy.Reencode(re))
 	}
 
 	if len(p.filters) > 0 {
@@ -137,7 +343,7 @@ func (p *Processor) start(conf fig.Properties) error {
 	}
 
 	servConf := serverConf{}
-	err := conf.GetValue("neve.web.server", &servConf)
+	err = conf.GetValue("neve.web.server", &servConf)
 	if err != nil {
 		return err
 	}
@@ -159,8 +365,14 @@ func (p *Processor) start(conf fig.Properties) error {
 	if servConf.ContextPath != "" {
 		router = router.Group(servConf.ContextPath)
 	}
+	// 每个Component的路由注册在独立的路由组中，由路由组记录所属的Component，
+	// 因此HttpRoutes中调用Use仅作用于该Component的路由
 	for _, v := range p.compList {
-		v.HttpRoutes(router)
+		v.HttpRoutes(router.Group("", componentHandler(componentName(v))))
+	}
+	err = p.startAdmin(conf, servConf, r)
+	if err != nil {
+		return err
 	}
 
 	addr := getServeAddr(servConf)
@@ -196,11 +408,169 @@ func (p *Processor) start(conf fig.Properties) error {
 	return nil
 }
 
+type namedComponent interface {
+	componentName() string
+}
+
+func componentHandler(name string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(ctxkey.Component, name)
+		ctx.Next()
+	}
+}
+
+func componentName(v Component) string {
+	if nc, ok := v.(namedComponent); ok {
+		return nc.componentName()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func (p *Processor) initMetrics(conf fig.Properties) error {
+	mc := metricsConf{}
+	err := conf.GetValue("neve.web.metrics", &mc)
+	if err != nil {
+		return err
+	}
+	if p.metrics == nil {
+		if !mc.Enable {
+			return nil
+		}
+		p.metrics = metrics.NewMetrics(
+			metrics.OptPath(mc.Path),
+			metrics.OptBuckets(mc.Buckets...),
+			metrics.OptSizeBuckets(mc.SizeBuckets...))
+		p.metricsAdmin = mc.Admin
+	}
+	return nil
+}
+
+func (p *Processor) initJsonEncoder(conf fig.Properties) error {
+	if p.jsonEncoder == nil {
+		policy := result.DefaultJsonPolicy()
+		if p.jsonPolicy != nil {
+			policy = *p.jsonPolicy
+		} else {
+			jc := jsonConf{}
+			err := conf.GetValue("neve.web.json", &jc)
+			if err != nil {
+				return err
+			}
+			if jc.TimeLayout != "" || jc.NilSliceAsEmpty {
+				return errors.New("gineve: neve.web.json.timeLayout and nilSliceAsEmpty are not supported, " +
+					"implement json.Marshaler for the type instead")
+			}
+			policy.Int64AsString = jc.Int64AsString
+			if jc.EscapeHTML != nil {
+				policy.EscapeHTML = *jc.EscapeHTML
+			}
+		}
+		// 默认策略与gin的输出一致，无需处理
+		if policy == result.DefaultJsonPolicy() {
+			return nil
+		}
+		p.jsonEncoder = result.NewJsonEncoder(policy)
+	}
+	result.SetJsonEncoder(p.jsonEncoder)
+	return nil
+}
+
+func (p *Processor) startAdmin(conf fig.Properties, servConf serverConf, r *gin.Engine) error {
+	ac := adminConf{}
+	err := conf.GetValue("neve.web.admin", &ac)
+	if err != nil {
+		return err
+	}
+	if !ac.Enable {
+		return nil
+	}
+	if ac.Path == "" {
+		ac.Path = "/admin"
+	}
+	admins := p.adminList
+	if rt := loghttp.GetRuntime(p.httpLogger); rt != nil {
+		admins = append(admins, rt)
+	}
+	if p.metrics != nil && p.metricsAdmin {
+		admins = append(admins, p.metrics)
+	}
+	for _, rec := range loghttp.GetRecorders(p.httpLogger) {
+		if v, ok := rec.(AdminComponent); ok {
+			admins = append(admins, v)
+		}
+	}
+
+	// 管理接口可以修改日志配置、查看请求数据，需要鉴权
+	handlers := p.adminFilters
+	if ac.Token != "" {
+		handlers = append(gin.HandlersChain{AdminTokenAuth(ac.Token)}, handlers...)
+	}
+
+	if ac.Port == 0 {
+		if len(handlers) == 0 && !ac.Public {
+			return errors.New("gineve: admin routes on the web server port require neve.web.admin.token, OptAddAdminFilters or neve.web.admin.public")
+		}
+		g := r.Group(ac.Path, handlers...)
+		for _, v := range admins {
+			v.AdminRoutes(g)
+		}
+		return nil
+	}
+
+	// 使用独立的端口
+	engine := gin.New()
+	if p.panicHandler != nil {
+		panicU := &recovery.RecoveryUtil{
+			Logger:       p.logger,
+			PanicHandler: p.panicHandler,
+		}
+		engine.Use(panicU.Recovery())
+	}
+	if len(p.filters) > 0 {
+		engine.Use(p.filters...)
+	}
+	g := engine.Group(ac.Path, handlers...)
+	for _, v := range admins {
+		v.AdminRoutes(g)
+	}
+	// 与业务服务使用相同的超时配置
+	s := &http.Server{
+		Addr:           fmt.Sprintf("%s:%d", ac.Host, ac.Port),
+		Handler:        engine,
+		ReadTimeout:    time.Duration(servConf.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(servConf.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(servConf.IdleTimeout) * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+	go func() {
+		err := s.ListenAndServe()
+		if err != nil {
+			p.logger.Errorln(err)
+		}
+	}()
+	p.adminServer = s
+	return nil
+}
+
 func (p *Processor) parseBean(comp Component) error {
 	p.compList = append(p.compList, comp)
 	return nil
 }
 
+func (p *Processor) parseController(o interface{}) error {
+	comp, err := newControllerComponent(o)
+	if err != nil {
+		return err
+	}
+	p.compList = append(p.compList, comp)
+	return nil
+}
+
+func (p *Processor) parseResource(res Resource) error {
+	p.compList = append(p.compList, newResourceComponent(res))
+	return nil
+}
+
 func (p *Processor) parseFilter(filter Filter) error {
 	p.filters = append(p.filters, filter.FilterHandler)
 	return nil
@@ -245,14 +615,68 @@ func OptSetDefaultHttpLogger(logger loghttp.HttpLogger, all bool) Opt {
 	}
 }
 
+// 设置全局日志的过滤与采样规则，优先级高于neve.web.log.include、exclude、sampling配置，
+// 仅在OptSetDefaultHttpLogger的all为true时生效
+func OptSetHttpLogFilter(f *loghttp.LogFilter) Opt {
+	return func(p *Processor) {
+		p.logFilter = f
+	}
+}
+
+// 开启绑定对象的日志（gin.Context.ShouldBind、gineve.Bind等绑定后校验时输出），优先级高于neve.web.log.bindBody配置。
+// routes为开启的路由，格式参考loghttp.RouteMatcher，为空时所有路由均开启。
+// 开启路由时仅gineve.Bind绑定的对象可以匹配路由。
+func OptEnableBindBodyLog(routes ...string) Opt {
+	return func(p *Processor) {
+		p.bindLogRoutes = append([]string{}, routes...)
+	}
+}
+
+// 设置HTTP指标，优先级高于neve.web.metrics配置。admin为true时在管理接口下提供，否则使用WEB服务的端口
+func OptSetMetrics(m *metrics.Metrics, admin bool) Opt {
+	return func(p *Processor) {
+		p.metrics = m
+		p.metricsAdmin = admin
+	}
+}
+
 func OptAddFilters(filters ...gin.HandlerFunc) Opt {
 	return func(p *Processor) {
 		p.filters = append(p.filters, filters...)
 	}
 }
 
+// 添加仅作用于管理接口的filter，如鉴权。管理接口同样经过OptAddFilters以及Filter bean
+func OptAddAdminFilters(filters ...gin.HandlerFunc) Opt {
+	return func(p *Processor) {
+		p.adminFilters = append(p.adminFilters, filters...)
+	}
+}
+
 func OptSetServerModifier(m ServerModifier) Opt {
 	return func(p *Processor) {
 		p.srvModifier = m
 	}
 }
+
+// 设置json编码策略，优先级高于neve.web.json配置
+func OptSetJsonPolicy(policy result.JsonPolicy) Opt {
+	return func(p *Processor) {
+		p.jsonPolicy = &policy
+	}
+}
+
+// 设置自定义的json编码器，优先级高于json编码策略。
+// 如果encoder同时实现了result.JsonReencoder，gin的json输出（如ctx.JSON）也将被重新编码。
+func OptSetJsonEncoder(encoder result.JsonEncoder) Opt {
+	return func(p *Processor) {
+		p.jsonEncoder = encoder
+	}
+}
+
+// 设置请求ID的生成器，优先级高于neve.web.requestId.generator配置
+func OptSetRequestIdGenerator(gen requestid.Generator) Opt {
+	return func(p *Processor) {
+		p.requestIdGen = gen
+	}
+}
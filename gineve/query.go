@@ -0,0 +1,282 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gineve
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-web/result"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	QueryPageKey   = "page"
+	QuerySizeKey   = "size"
+	QuerySortKey   = "sort"
+	QueryFilterKey = "filter"
+
+	HeaderTotalCount = "X-Total-Count"
+	HeaderLink       = "Link"
+
+	DefaultPageSize    = 20
+	DefaultMaxPageSize = 1000
+
+	// 当前请求使用的QueryParser，由Processor按neve.web.query配置设置
+	QueryParserKey = "_NEVE_QUERY_PARSER"
+)
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// 分页、排序、过滤查询参数，格式如：
+// ?page=2&size=20&sort=-createdAt,name&filter[status]=x
+type Query struct {
+	// 页码，从1开始
+	Page int
+	Size int
+	Sort []SortField
+	// filter[field]=value
+	Filter map[string]string
+}
+
+func (q *Query) Offset() int {
+	return (q.Page - 1) * q.Size
+}
+
+// 根据总数生成分页信息
+func (q *Query) PageInfo(total int64) *result.Page {
+	return result.NewPage(q.Page, q.Size, total)
+}
+
+type queryConf struct {
+	DefaultSize int
+	MaxSize     int
+}
+
+type QueryParser struct {
+	defaultSize int
+	maxSize     int
+	// 允许排序的字段，为空则不限制
+	sortFields map[string]bool
+	// 允许过滤的字段，为空则不限制
+	filterFields map[string]bool
+}
+
+type QueryOpt func(p *QueryParser)
+
+var defaultQueryParser = NewQueryParser()
+
+func NewQueryParser(opts ...QueryOpt) *QueryParser {
+	ret := &QueryParser{
+		defaultSize: DefaultPageSize,
+		maxSize:     DefaultMaxPageSize,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// 按neve.web.query配置创建QueryParser，defaultSize大于maxSize时返回错误
+func NewQueryParserFromConfig(conf fig.Properties) (*QueryParser, error) {
+	qc := queryConf{}
+	err := conf.GetValue("neve.web.query", &qc)
+	if err != nil {
+		return nil, err
+	}
+	ret := NewQueryParser(OptQueryDefaultSize(qc.DefaultSize), OptQueryMaxSize(qc.MaxSize))
+	if ret.defaultSize > ret.maxSize {
+		return nil, fmt.Errorf("gineve: neve.web.query.defaultSize %d exceeds maxSize %d", ret.defaultSize, ret.maxSize)
+	}
+	return ret, nil
+}
+
+// 设置全局默认的QueryParser，请求中未设置QueryParser（参考QueryParserHandler）时使用
+func SetDefaultQueryParser(p *QueryParser) {
+	if p != nil {
+		defaultQueryParser = p
+	}
+}
+
+// 在请求中设置QueryParser，Processor按neve.web.query配置为所有请求设置
+func QueryParserHandler(p *QueryParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(QueryParserKey, p)
+	}
+}
+
+// 获得请求中设置的QueryParser，未设置时返回默认的QueryParser
+func GetQueryParser(ctx *gin.Context) *QueryParser {
+	if v, ok := ctx.Get(QueryParserKey); ok {
+		if p, ok := v.(*QueryParser); ok && p != nil {
+			return p
+		}
+	}
+	return defaultQueryParser
+}
+
+// 使用请求中的QueryParser（参考GetQueryParser）解析查询参数，opts用于定制当前接口的校验规则，如允许排序的字段
+func ParseQuery(ctx *gin.Context, opts ...QueryOpt) (*Query, error) {
+	return GetQueryParser(ctx).Clone(opts...).Parse(ctx)
+}
+
+func (p *QueryParser) Clone(opts ...QueryOpt) *QueryParser {
+	if len(opts) == 0 {
+		return p
+	}
+	ret := &QueryParser{
+		defaultSize:  p.defaultSize,
+		maxSize:      p.maxSize,
+		sortFields:   p.sortFields,
+		filterFields: p.filterFields,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+func (p *QueryParser) Parse(ctx *gin.Context) (*Query, error) {
+	values := ctx.Request.URL.Query()
+	ret := &Query{
+		Page:   1,
+		Size:   p.defaultSize,
+		Filter: map[string]string{},
+	}
+
+	var err error
+	if v := values.Get(QueryPageKey); v != "" {
+		ret.Page, err = strconv.Atoi(v)
+		if err != nil || ret.Page < 1 {
+			return nil, fmt.Errorf("gineve: query %s %q is invalid", QueryPageKey, v)
+		}
+	}
+	if v := values.Get(QuerySizeKey); v != "" {
+		ret.Size, err = strconv.Atoi(v)
+		if err != nil || ret.Size < 1 {
+			return nil, fmt.Errorf("gineve: query %s %q is invalid", QuerySizeKey, v)
+		}
+		if p.maxSize > 0 && ret.Size > p.maxSize {
+			return nil, fmt.Errorf("gineve: query %s %d exceeds the maximum %d", QuerySizeKey, ret.Size, p.maxSize)
+		}
+	}
+	for _, v := range values[QuerySortKey] {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			sf := SortField{Field: f}
+			if f[0] == '-' || f[0] == '+' {
+				sf.Field, sf.Desc = f[1:], f[0] == '-'
+			}
+			if sf.Field == "" {
+				return nil, fmt.Errorf("gineve: query %s %q is invalid", QuerySortKey, v)
+			}
+			if len(p.sortFields) > 0 && !p.sortFields[sf.Field] {
+				return nil, fmt.Errorf("gineve: sort by %q is not allowed", sf.Field)
+			}
+			ret.Sort = append(ret.Sort, sf)
+		}
+	}
+	for k, vs := range values {
+		if !strings.HasPrefix(k, QueryFilterKey+"[") || !strings.HasSuffix(k, "]") {
+			continue
+		}
+		field := k[len(QueryFilterKey)+1 : len(k)-1]
+		if field == "" || len(vs) == 0 {
+			continue
+		}
+		if len(p.filterFields) > 0 && !p.filterFields[field] {
+			return nil, fmt.Errorf("gineve: filter by %q is not allowed", field)
+		}
+		ret.Filter[field] = vs[0]
+	}
+	return ret, nil
+}
+
+// 输出X-Total-Count以及Link（first、prev、next、last）响应头
+func WritePageHeaders(ctx *gin.Context, q *Query, total int64) {
+	ctx.Header(HeaderTotalCount, strconv.FormatInt(total, 10))
+
+	page := q.PageInfo(total)
+	links := make([]string, 0, 4)
+	links = append(links, pageLink(ctx.Request.URL, 1, q.Size, "first"))
+	if q.Page > 1 {
+		links = append(links, pageLink(ctx.Request.URL, q.Page-1, q.Size, "prev"))
+	}
+	if q.Page < page.Pages {
+		links = append(links, pageLink(ctx.Request.URL, q.Page+1, q.Size, "next"))
+	}
+	if page.Pages > 0 {
+		links = append(links, pageLink(ctx.Request.URL, page.Pages, q.Size, "last"))
+	}
+	ctx.Header(HeaderLink, strings.Join(links, ", "))
+}
+
+func pageLink(u *url.URL, page, size int, rel string) string {
+	values := u.Query()
+	values.Set(QueryPageKey, strconv.Itoa(page))
+	values.Set(QuerySizeKey, strconv.Itoa(size))
+	link := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return fmt.Sprintf("<%s>; rel=\"%s\"", link.String(), rel)
+}
+
+func OptQueryDefaultSize(size int) QueryOpt {
+	return func(p *QueryParser) {
+		if size > 0 {
+			p.defaultSize = size
+		}
+	}
+}
+
+// 设置size的最大值，小于等于0时使用DefaultMaxPageSize
+func OptQueryMaxSize(size int) QueryOpt {
+	return func(p *QueryParser) {
+		if size > 0 {
+			p.maxSize = size
+		}
+	}
+}
+
+func OptQuerySortFields(fields ...string) QueryOpt {
+	return func(p *QueryParser) {
+		p.sortFields = toSet(fields)
+	}
+}
+
+func OptQueryFilterFields(fields ...string) QueryOpt {
+	return func(p *QueryParser) {
+		p.filterFields = toSet(fields)
+	}
+}
+
+func toSet(s []string) map[string]bool {
+	if len(s) == 0 {
+		return nil
+	}
+	ret := make(map[string]bool, len(s))
+	for _, v := range s {
+		ret[v] = true
+	}
+	return ret
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gineve
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/result"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	ResourceIdParam = "id"
+)
+
+var (
+	ErrNotFound = errors.New("gineve: resource not found")
+	ErrConflict = errors.New("gineve: resource conflict")
+)
+
+// Resource为标准的RESTful资源，Processor会以ResourceName为前缀挂载以下路由：
+//
+//	GET    /{name}      List
+//	GET    /{name}/:id  Get
+//	POST   /{name}      Create
+//	PUT    /{name}/:id  Update
+//	PATCH  /{name}/:id  Patch
+//	DELETE /{name}/:id  Delete
+//
+// 资源不存在时返回ErrNotFound（或result.NotFoundError），冲突（如重复创建）时返回ErrConflict（或result.ConflictError），
+// 分别输出404、409，ErrNotFound、ErrConflict可以被包装（errors.Is）；其他错误的处理参考WriteResult。
+type Resource interface {
+	// 资源名称，如"users"
+	ResourceName() string
+	// 创建新的资源对象，用于绑定Create、Update的请求数据，如&User{}
+	NewResource() interface{}
+
+	// 返回当前页的数据以及总数
+	List(ctx *gin.Context, query *Query) (interface{}, int64, error)
+	// 资源不存在时返回nil（包括类型化的nil指针）或ErrNotFound
+	Get(ctx *gin.Context, id string) (interface{}, error)
+	Create(ctx *gin.Context, obj interface{}) (interface{}, error)
+	Update(ctx *gin.Context, id string, obj interface{}) (interface{}, error)
+	Patch(ctx *gin.Context, id string, patch map[string]interface{}) (interface{}, error)
+	Delete(ctx *gin.Context, id string) error
+}
+
+// Resource可选实现，用于定制List查询参数的校验规则，如允许排序、过滤的字段
+type ResourceQueryOpts interface {
+	QueryOpts() []QueryOpt
+}
+
+type resourceComponent struct {
+	res Resource
+}
+
+func newResourceComponent(res Resource) *resourceComponent {
+	return &resourceComponent{res: res}
+}
+
+// 将Resource转换为Component，路由与Processor注册的一致
+func NewResourceComponent(res Resource) Component {
+	return newResourceComponent(res)
+}
+
+func (c *resourceComponent) componentName() string {
+	return fmt.Sprintf("%T", c.res)
+}
+
+func (c *resourceComponent) HttpRoutes(engine gin.IRouter) {
+	name := "/" + strings.Trim(c.res.ResourceName(), "/")
+	item := name + "/:" + ResourceIdParam
+	prefix := c.componentName() + "."
+	engine.GET(name, namedHandler(prefix+"List", c.list))
+	engine.GET(item, namedHandler(prefix+"Get", c.get))
+	engine.POST(name, namedHandler(prefix+"Create", c.create))
+	engine.PUT(item, namedHandler(prefix+"Update", c.update))
+	engine.PATCH(item, namedHandler(prefix+"Patch", c.patch))
+	engine.DELETE(item, namedHandler(prefix+"Delete", c.delete))
+}
+
+func (c *resourceComponent) list(ctx *gin.Context) {
+	var opts []QueryOpt
+	if v, ok := c.res.(ResourceQueryOpts); ok {
+		opts = v.QueryOpts()
+	}
+	q, err := ParseQuery(ctx, opts...)
+	if err != nil {
+		writeBadRequest(ctx, err)
+		return
+	}
+	data, total, err := c.res.List(ctx, q)
+	if err != nil {
+		writeResourceResult(ctx, nil, err)
+		return
+	}
+	WritePageHeaders(ctx, q, total)
+	WriteResult(ctx, result.OkPage(data, q.PageInfo(total)), nil)
+}
+
+func (c *resourceComponent) get(ctx *gin.Context) {
+	data, err := c.res.Get(ctx, ctx.Param(ResourceIdParam))
+	if err == nil && isNil(data) {
+		err = ErrNotFound
+	}
+	writeResourceResult(ctx, data, err)
+}
+
+func (c *resourceComponent) create(ctx *gin.Context) {
+	obj := c.res.NewResource()
+	if err := Bind(ctx, obj); err != nil {
+		writeBadRequest(ctx, err)
+		return
+	}
+	data, err := c.res.Create(ctx, obj)
+	if err != nil {
+		writeResourceResult(ctx, nil, err)
+		return
+	}
+	ret := result.Ok(data)
+	ret.SetHttpStatus(http.StatusCreated)
+	WriteResult(ctx, ret, nil)
+}
+
+func (c *resourceComponent) update(ctx *gin.Context) {
+	obj := c.res.NewResource()
+	if err := Bind(ctx, obj); err != nil {
+		writeBadRequest(ctx, err)
+		return
+	}
+	data, err := c.res.Update(ctx, ctx.Param(ResourceIdParam), obj)
+	writeResourceResult(ctx, data, err)
+}
+
+func (c *resourceComponent) patch(ctx *gin.Context) {
+	patch := map[string]interface{}{}
+	if err := ctx.ShouldBindJSON(&patch); err != nil {
+		writeBadRequest(ctx, err)
+		return
+	}
+	data, err := c.res.Patch(ctx, ctx.Param(ResourceIdParam), patch)
+	writeResourceResult(ctx, data, err)
+}
+
+func (c *resourceComponent) delete(ctx *gin.Context) {
+	err := c.res.Delete(ctx, ctx.Param(ResourceIdParam))
+	writeResourceResult(ctx, result.OK, err)
+}
+
+// 将ErrNotFound、ErrConflict转换为对应的result
+func writeResourceResult(ctx *gin.Context, data interface{}, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		err = result.NotFoundError.Clone()
+	case errors.Is(err, ErrConflict):
+		err = result.ConflictError.Clone()
+	}
+	WriteResult(ctx, data, err)
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func writeBadRequest(ctx *gin.Context, err error) {
+	result.BadRequestError.Clone().SetMessage(err.Error()).WriteJson(ctx)
+	ctx.Abort()
+}
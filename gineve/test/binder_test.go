@@ -0,0 +1,218 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-web/gineve"
+	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"github.com/xfali/xlog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindReq struct {
+	Id     int64     `path:"id"`
+	Q      string    `query:"q" default:"all"`
+	Size   int       `query:"size" default:"10"`
+	Tenant string    `header:"X-Tenant"`
+	Sid    string    `cookie:"sid"`
+	Since  time.Time `query:"since" time_format:"2006-01-02"`
+	Tags   []string  `query:"tag" sep:","`
+	Name   string    `json:"name"`
+}
+
+func TestBind(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var got bindReq
+	r.POST("/users/:id", func(ctx *gin.Context) {
+		if err := gineve.Bind(ctx, &got); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/42?size=20&since=2024-01-02&tag=a,b&tag=c", strings.NewReader(`{"name":"neve"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "t1")
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200 but get %d", w.Code)
+	}
+	if got.Id != 42 || got.Q != "all" || got.Size != 20 || got.Tenant != "t1" || got.Sid != "s1" || got.Name != "neve" {
+		t.Fatal(got)
+	}
+	if got.Since.Format("2006-01-02") != "2024-01-02" {
+		t.Fatal(got.Since)
+	}
+	if strings.Join(got.Tags, "|") != "a|b|c" {
+		t.Fatal(got.Tags)
+	}
+}
+
+func TestBindError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/users/:id", func(ctx *gin.Context) {
+		var req bindReq
+		if err := gineve.Bind(ctx, &req); err != nil {
+			t.Log(err)
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 but get %d", w.Code)
+	}
+
+	r.GET("/map", func(ctx *gin.Context) {
+		m := map[string]string{}
+		if err := gineve.Bind(ctx, &m); err == nil {
+			t.Fatal("expect error for non-struct target")
+		}
+		var list []bindReq
+		if err := gineve.Bind(ctx, &list); err == nil {
+			t.Fatal("expect error for non-struct target")
+		}
+		ctx.Status(http.StatusOK)
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/map", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200 but get %d", w.Code)
+	}
+}
+
+type countValidator struct {
+	count int
+}
+
+func (v *countValidator) ValidateStruct(obj interface{}) error {
+	v.count++
+	return nil
+}
+
+func (v *countValidator) Engine() interface{} {
+	return nil
+}
+
+// 记录Infof输出的日志
+type captureLogger struct {
+	xlog.Logger
+	buf bytes.Buffer
+}
+
+func (l *captureLogger) Infof(format string, args ...interface{}) {
+	fmt.Fprintf(&l.buf, format, args...)
+}
+
+type bindLogReq struct {
+	Name     string `json:"name"`
+	Phone    string `json:"phone" mask:"phone"`
+	Password string `json:"password"`
+}
+
+func TestBindLog(t *testing.T) {
+	origin := binding.Validator
+	defer func() {
+		binding.Validator = origin
+	}()
+	cv := &countValidator{}
+	logger := &captureLogger{Logger: xlog.GetLogger()}
+	redactor, err := loghttp.NewRedactor(nil, []string{"password"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := loghttp.NewRequestBodyLogWriter(logger, cv, redactor, "POST /users/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重复包装时使用原始的StructValidator
+	w, err = loghttp.NewRequestBodyLogWriter(logger, w, redactor, "POST /users/*")
+	if err != nil || w.V != cv {
+		t.Fatal(err, w.V)
+	}
+	binding.Validator = w
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/users/:id", func(ctx *gin.Context) {
+		var req bindLogReq
+		if err := gineve.Bind(ctx, &req); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+	// 通过ShouldBind绑定的对象无法获得请求，配置routes时不输出
+	r.POST("/users/:id/plain", func(ctx *gin.Context) {
+		var req bindLogReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+	body := `{"name":"neve","phone":"13812345678","password":"secret"}`
+	for _, target := range []string{"/users/1", "/users/1/plain"} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatal(target, resp.Code)
+		}
+	}
+	if cv.count != 2 {
+		t.Fatal(cv.count)
+	}
+	out := logger.buf.String()
+	if strings.Count(out, "[bind]") != 1 || !strings.Contains(out, "[path]: /users/1 ,") ||
+		!strings.Contains(out, `"name":"neve"`) || !strings.Contains(out, `"phone":"138****5678"`) ||
+		strings.Contains(out, "13812345678") || strings.Contains(out, "secret") {
+		t.Fatal(out)
+	}
+
+	if _, err := loghttp.NewRequestBodyLogWriter(xlog.GetLogger(), cv, nil, "GET"); err == nil {
+		t.Fatal("expect invalid route error")
+	}
+	// 未配置bindBody.level时使用neve.web.log.level
+	conf, err := fig.LoadYamlFile("assets/config-bindlog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err = loghttp.NewRequestBodyLogWriterFromConfig(conf, xlog.GetLogger(), cv, nil)
+	if err != nil || w == nil || w.Level != "warn" || len(w.Routes) != 1 {
+		t.Fatal(err, w)
+	}
+}
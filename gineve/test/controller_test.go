@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/gineve"
+	"github.com/xfali/neve-web/result"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type user struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type getUserReq struct {
+	Id int64 `path:"id"`
+}
+
+type userController struct {
+	getUser gineve.Route `route:"GET /users/:id" handler:"GetUser"`
+}
+
+func (c *userController) GetUser(req *getUserReq) (*user, error) {
+	if req.Id == 0 {
+		return nil, result.BadRequestError.Clone()
+	}
+	return &user{Id: req.Id, Name: "neve"}, nil
+}
+
+func (c *userController) RouteTable() map[string]string {
+	return map[string]string{
+		"DeleteUser": "DELETE /users/:id",
+		"FailUser":   "POST /users/:id/fail",
+	}
+}
+
+func (c *userController) DeleteUser(ctx *gin.Context) error {
+	if ctx.Param("id") == "0" {
+		return result.NotFoundError.Clone()
+	}
+	return nil
+}
+
+type dbError struct {
+	Dsn string
+}
+
+func (e *dbError) Error() string {
+	return "connect " + e.Dsn + " failed"
+}
+
+func (c *userController) FailUser(req *getUserReq) error {
+	return &dbError{Dsn: "root:secret@tcp(db:3306)"}
+}
+
+type badController struct{}
+
+func (c *badController) RouteTable() map[string]string {
+	return map[string]string{
+		"NotExists": "GET /users",
+	}
+}
+
+func TestHandle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	c := &userController{}
+	r.GET("/users/:id", gineve.Handle(c.GetUser))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200 but get %d", w.Code)
+	}
+	ret := struct {
+		Code int64 `json:"code"`
+		Data user  `json:"data"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Code != 0 || ret.Data.Id != 1 || ret.Data.Name != "neve" {
+		t.Fatal(w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 but get %d", w.Code)
+	}
+}
+
+func TestClassifyController(t *testing.T) {
+	p := gineve.NewProcessor()
+	ok, err := p.Classify(&userController{})
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	ok, err = p.Classify(&badController{})
+	if !ok || err == nil {
+		t.Fatal("expect error")
+	}
+	t.Log(err)
+}
+
+func TestControllerRoutes(t *testing.T) {
+	comp, err := gineve.NewControllerComponent(&userController{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	comp.HttpRoutes(r)
+
+	// Route tag声明的路由，绑定path参数
+	w := serve(r, "/users/5")
+	if w.Code != http.StatusOK || w.Body.String() != `{"code":0,"message":"ok","data":{"id":5,"name":"neve"}}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = serve(r, "/users/0")
+	if w.Code != http.StatusBadRequest {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = serve(r, "/users/abc")
+	if w.Code != http.StatusBadRequest {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	// RouteTable声明的路由
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"code":0,"message":"ok"}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/0", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	// 非result.Result的错误不输出给客户端
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/1/fail", nil))
+	if w.Code != http.StatusInternalServerError || w.Body.String() != `{"code":-1,"message":"internal error"}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
@@ -104,6 +104,16 @@ func (b *webBean) HttpRoutes(engine gin.IRouter) {
 		context.Writer.WriteString(string(d))
 	})
 
+	engine.POST("/json", b.HttpLogger.OptLogHttp(loghttp.OptLogFormat(loghttp.LogFormatJson)), func(context *gin.Context) {
+		d, err := context.GetRawData()
+		if err != nil {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		context.Writer.WriteString(string(d))
+	})
+
 	engine.POST("/error", b.HttpLogger.OptLogHttp(loghttp.OptLogLevel("error")), func(context *gin.Context) {
 		d, err := context.GetRawData()
 		if err != nil {
@@ -0,0 +1,733 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-web/gineve"
+	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"github.com/xfali/neve-web/gineve/midware/recovery"
+	"github.com/xfali/xlog"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newExchange() *loghttp.Exchange {
+	return &loghttp.Exchange{
+		RequestId: "abc",
+		Start:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Latency:   1500 * time.Microsecond,
+		Method:    http.MethodGet,
+		Path:      "/users/1",
+		Route:     "/users/:id",
+		Query:     "a=b",
+		ClientIP:  "127.0.0.1",
+		Proto:     "HTTP/1.1",
+		UserAgent: "curl/7.0",
+		Status:    http.StatusOK,
+		BytesOut:  42,
+	}
+}
+
+func TestFormatter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	e := newExchange()
+
+	loghttp.GetFormatter(loghttp.LogFormatCombined).FormatResponse(buf, e)
+	if buf.String() != `127.0.0.1 - - [02/Jan/2024:03:04:05 +0000] "GET /users/1?a=b HTTP/1.1" 200 42 "-" "curl/7.0"` {
+		t.Fatal(buf.String())
+	}
+
+	buf.Reset()
+	loghttp.GetFormatter(loghttp.LogFormatJson).FormatRequest(buf, e)
+	if buf.Len() != 0 {
+		t.Fatal(buf.String())
+	}
+	loghttp.GetFormatter(loghttp.LogFormatJson).FormatResponse(buf, e)
+	if buf.String() != `{"time":"2024-01-02T03:04:05Z","request_id":"abc","method":"GET","path":"/users/1","route":"/users/:id","query":"a=b","status":200,"latency_ms":1.500,"client_ip":"127.0.0.1","user_agent":"curl/7.0","bytes_in":0,"bytes_out":42}` {
+		t.Fatal(buf.String())
+	}
+
+	buf.Reset()
+	loghttp.GetFormatter(loghttp.LogFormatLogfmt).FormatResponse(buf, e)
+	if buf.String() != `time=2024-01-02T03:04:05Z request_id=abc method=GET path=/users/1 route=/users/:id query="a=b" status=200 latency_ms=1.500 client_ip=127.0.0.1 user_agent=curl/7.0 bytes_in=0 bytes_out=42` {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := loghttp.NewRedactor([]string{"authorization"}, []string{"password", "user.token"}, []string{`\d{16}`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newExchange()
+	e.Query = "card=6222000011112222"
+	e.RequestHeader = http.Header{"Authorization": {"Bearer x"}, "X-Trace": {"1"}}
+	e.RequestContentType = "application/json"
+	e.RequestBody = []byte(`{"user":{"name":"neve","token":"t","password":"p"},"token":"keep","list":[{"password":"p"}]}`)
+	r.RedactRequest(e)
+	if e.Query != "card=******" || e.RequestHeader.Get("Authorization") != "******" || e.RequestHeader.Get("X-Trace") != "1" {
+		t.Fatal(e.Query, e.RequestHeader)
+	}
+	if string(e.RequestBody) != `{"user":{"name":"neve","token":"******","password":"******"},"token":"keep","list":[{"password":"******"}]}` {
+		t.Fatal(string(e.RequestBody))
+	}
+
+	body := r.RedactBody("application/x-www-form-urlencoded", []byte("name=neve&password=123"))
+	if string(body) != "name=neve&password=%2A%2A%2A%2A%2A%2A" {
+		t.Fatal(string(body))
+	}
+
+	// 截断的json
+	body = r.RedactBody("application/json", []byte(`{"name":"neve","password":"123`))
+	if string(body) != `{"name":"neve","password":"******"` {
+		t.Fatal(string(body))
+	}
+
+	// query按字段名脱敏
+	if q := r.RedactQuery("name=neve&password=123&card=6222000011112222"); q != "name=neve&password=%2A%2A%2A%2A%2A%2A&card=******" {
+		t.Fatal(q)
+	}
+
+	// 默认脱敏的header
+	d := loghttp.NewDefaultRedactor()
+	h := d.RedactHeader(http.Header{"X-Api-Key": {"k"}, "X-Auth-Token": {"t"}, "X-Trace": {"1"}})
+	if h.Get("X-Api-Key") != "******" || h.Get("X-Auth-Token") != "******" || h.Get("X-Trace") != "1" {
+		t.Fatal(h)
+	}
+}
+
+type recordFormatter struct {
+	e     loghttp.Exchange
+	count int
+}
+
+func (f *recordFormatter) FormatRequest(buf *bytes.Buffer, e *loghttp.Exchange) {}
+
+func (f *recordFormatter) FormatResponse(buf *bytes.Buffer, e *loghttp.Exchange) {
+	f.count++
+	f.e = *e
+	f.e.RequestBody = append([]byte(nil), e.RequestBody...)
+	f.e.ResponseBody = append([]byte(nil), e.ResponseBody...)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	f := &recordFormatter{}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f), loghttp.OptLogMaxBodySize(8))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/echo", logger.LogHttp(), func(ctx *gin.Context) {
+		d, _ := ctx.GetRawData()
+		ctx.Writer.Write(d)
+	})
+	body := strings.Repeat("0123456789", 10)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body)))
+	if w.Body.String() != body {
+		t.Fatal("body must not be modified: ", w.Body.String())
+	}
+	if string(f.e.RequestBody) != "01234567" || !f.e.RequestBodyTruncated || f.e.BytesIn != 100 {
+		t.Fatal(string(f.e.RequestBody), f.e.RequestBodyTruncated, f.e.BytesIn)
+	}
+	if string(f.e.ResponseBody) != "01234567" || !f.e.ResponseBodyTruncated || f.e.BytesOut != 100 {
+		t.Fatal(string(f.e.ResponseBody), f.e.ResponseBodyTruncated, f.e.BytesOut)
+	}
+}
+
+func TestBodyPolicy(t *testing.T) {
+	f := &recordFormatter{}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/upload", logger.LogHttp(), func(ctx *gin.Context) {
+		if _, err := ctx.MultipartForm(); err != nil {
+			t.Fatal(err)
+		}
+		ctx.Data(http.StatusOK, "image/png", []byte{0x89, 'P', 'N', 'G'})
+	})
+
+	body := bytes.NewBuffer(nil)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("name", "neve")
+	fw, _ := mw.CreateFormFile("file", "foo.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.Len() != 4 {
+		t.Fatal(w.Body.Bytes())
+	}
+	if f.e.RequestBodySummary != "multipart: 2 parts, file foo.png 3B" || len(f.e.RequestBody) != 0 {
+		t.Fatal(f.e.RequestBodySummary)
+	}
+	if f.e.ResponseBodySummary != "image/png: 4B" || len(f.e.ResponseBody) != 0 {
+		t.Fatal(f.e.ResponseBodySummary)
+	}
+}
+
+func TestSlow(t *testing.T) {
+	f := &recordFormatter{}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f), loghttp.OptLogSlowThreshold(20*time.Millisecond))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/slow", logger.LogHttp(), func(ctx *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		ctx.Status(http.StatusNoContent)
+	})
+	r.GET("/fast", logger.LogHttp(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	serve(r, "/slow")
+	if !f.e.Slow {
+		t.Fatal("expect slow")
+	}
+	serve(r, "/fast")
+	if f.e.Slow {
+		t.Fatal("expect not slow")
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	f := &recordFormatter{}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f))
+	filter, err := loghttp.NewLogFilter(nil, []string{"/health", "/static/**"}, []loghttp.SamplingRule{{Path: "GET /items/:id", Rate: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(filter.Wrap(logger.LogHttp()))
+	r.GET("/health", func(ctx *gin.Context) {})
+	r.GET("/static/*file", func(ctx *gin.Context) {})
+	r.GET("/items/:id", func(ctx *gin.Context) {
+		if ctx.Param("id") == "0" {
+			ctx.Status(http.StatusNotFound)
+		}
+	})
+	r.GET("/users", func(ctx *gin.Context) {})
+
+	for _, target := range []string{"/health", "/static/js/app.js", "/items/1"} {
+		serve(r, target)
+		if f.count != 0 {
+			t.Fatal(target, " must not be logged")
+		}
+	}
+	serve(r, "/items/0")
+	if f.count != 1 || f.e.Status != http.StatusNotFound {
+		t.Fatal("failed request must be logged")
+	}
+	serve(r, "/users")
+	if f.count != 2 {
+		t.Fatal("/users must be logged")
+	}
+}
+
+func TestAsync(t *testing.T) {
+	f := &recordFormatter{}
+	sink, err := loghttp.NewAsyncSink(16, 1, loghttp.OverflowBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f), loghttp.OptLogAsync(sink))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/echo", logger.LogHttp(), func(ctx *gin.Context) {
+		d, _ := ctx.GetRawData()
+		ctx.Writer.Write(d)
+	})
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello")))
+	}
+	logger.Close()
+	// 每个请求分别输出请求以及响应
+	if f.count != 100 || sink.Stats().Written != 200 || sink.Stats().Dropped != 0 {
+		t.Fatal(f.count, sink.Stats())
+	}
+	if string(f.e.RequestBody) != "hello" || string(f.e.ResponseBody) != "hello" {
+		t.Fatal(string(f.e.RequestBody), string(f.e.ResponseBody))
+	}
+
+	for name, expect := range map[string]string{
+		"":            loghttp.OverflowDropNewest,
+		"drop-oldest": loghttp.OverflowDropOldest,
+		"drop-newest": loghttp.OverflowDropNewest,
+		"Block":       loghttp.OverflowBlock,
+	} {
+		if v, err := loghttp.ParseOverflow(name); err != nil || v != expect {
+			t.Fatal(name, v, err)
+		}
+	}
+	if _, err := loghttp.NewAsyncSink(16, 1, "drop-last"); err == nil {
+		t.Fatal("expect unknown overflow error")
+	}
+	conf, err := fig.LoadYamlFile("assets/config-async-invalid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loghttp.CheckConfig(conf); err == nil {
+		t.Fatal("expect unknown overflow error")
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	for _, name := range []string{"route", "level", "format", "file", "har", "inspector"} {
+		conf, err := fig.LoadYamlFile("assets/config-log-invalid-" + name + ".yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := loghttp.CheckConfig(conf); err == nil {
+			t.Fatal("expect invalid config error: " + name)
+		}
+		if _, err := loghttp.NewFromConfig(conf, xlog.GetLogger()); err == nil {
+			t.Fatal("expect invalid config error: " + name)
+		}
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loghttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 同前缀的其他文件不会被清理
+	others := []string{"access-old.log", "access-2024.log", "access-2024-01-02T03-04-05.000.bak.log"}
+	for _, name := range others {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := loghttp.NewRotateWriter(filepath.Join(dir, "access.log"),
+		loghttp.OptRotateMaxSize(64),
+		loghttp.OptRotateMaxBackups(2),
+		loghttp.OptRotateCompress(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("x", 39) + "\n")
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	infos, _ := ioutil.ReadDir(dir)
+	gz := 0
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".log.gz") {
+			gz++
+		} else if info.Name() != "access.log" && info.Name() != others[0] && info.Name() != others[1] && info.Name() != others[2] {
+			t.Fatal("unexpected file: ", info.Name())
+		}
+	}
+	if gz != 2 || len(infos) != 3+len(others) {
+		t.Fatalf("expect 2 backups but get %d, files: %d", gz, len(infos))
+	}
+	if _, err := w.Write(line); err != os.ErrClosed {
+		t.Fatal("expect ErrClosed but get: ", err)
+	}
+
+	// 同一时间的备份按序号排序，序号大的更新
+	stamp := "app-2024-01-02T03-04-05.000"
+	for _, name := range []string{"app-2024-01-01T03-04-05.000.log", stamp + ".log", stamp + ".1.log", stamp + ".2.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err = loghttp.NewRotateWriter(filepath.Join(dir, "app.log"),
+		loghttp.OptRotateMaxSize(64),
+		loghttp.OptRotateMaxBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	for name, exists := range map[string]bool{
+		stamp + ".2.log":                  true,
+		stamp + ".1.log":                  false,
+		stamp + ".log":                    false,
+		"app-2024-01-01T03-04-05.000.log": false,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != exists {
+			t.Fatal(name, exists, err)
+		}
+	}
+}
+
+func TestRouteSetting(t *testing.T) {
+	f := &recordFormatter{}
+	disable := false
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f),
+		loghttp.OptLogRoutes(loghttp.RouteSetting{Path: "POST /secret/**", RequestBody: &disable}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	echo := func(ctx *gin.Context) {
+		d, _ := ctx.GetRawData()
+		ctx.Writer.Write(d)
+	}
+	// 注入的logger clone后同样生效
+	r.POST("/secret/:id", logger.OptLogHttp(loghttp.EnableLogReqBody()), echo)
+	r.POST("/public", logger.LogHttp(), echo)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/secret/1", strings.NewReader("password")))
+	if w.Body.String() != "password" || f.e.RequestBody != nil || string(f.e.ResponseBody) != "password" {
+		t.Fatal(w.Body.String(), string(f.e.RequestBody))
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/public", strings.NewReader("hello")))
+	if string(f.e.RequestBody) != "hello" {
+		t.Fatal(string(f.e.RequestBody))
+	}
+}
+
+func routeInfoHandler(ctx *gin.Context) {
+	ctx.Status(http.StatusNoContent)
+}
+
+func TestRouteInfo(t *testing.T) {
+	f := &recordFormatter{}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(ctx *gin.Context) {
+		ctx.Set(loghttp.ComponentKey, "users")
+	}, logger.LogHttp())
+	r.GET("/users/:id", routeInfoHandler)
+
+	serve(r, "/users/1")
+	if f.e.Route != "/users/:id" || !strings.HasSuffix(f.e.Handler, "routeInfoHandler") || f.e.Component != "users" || f.e.Unmatched {
+		t.Fatal(f.e.Route, f.e.Handler, f.e.Component)
+	}
+
+	serve(r, "/none")
+	if f.e.Status != http.StatusNotFound || !f.e.Unmatched || f.e.Route != "" || f.e.Handler != "" {
+		t.Fatal(f.e.Status, f.e.Route, f.e.Handler)
+	}
+}
+
+func TestFailureInfo(t *testing.T) {
+	f := &recordFormatter{}
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f))
+	panicU := &recovery.RecoveryUtil{
+		Logger: xlog.GetLogger(),
+		PanicHandler: func(ctx *gin.Context, err interface{}) {
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(panicU.Recovery(), logger.LogHttp())
+	r.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/abort", func(ctx *gin.Context) {
+		_ = ctx.Error(errors.New("no permission"))
+		loghttp.AbortWithReason(ctx, http.StatusForbidden, "denied")
+	})
+
+	w := serve(r, "/panic")
+	if w.Code != http.StatusInternalServerError || f.e.Panic != "boom" || f.e.Status != http.StatusInternalServerError {
+		t.Fatal(w.Code, f.e.Panic, f.e.Status)
+	}
+	serve(r, "/abort")
+	if !f.e.Aborted || f.e.AbortReason != "denied" || len(f.e.Errors) != 1 || f.e.Errors[0] != "no permission" {
+		t.Fatal(f.e.Aborted, f.e.AbortReason, f.e.Errors)
+	}
+
+	// 日志在recovery之前
+	r = gin.New()
+	r.Use(logger.LogHttp(), panicU.Recovery())
+	r.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+	serve(r, "/panic")
+	if f.e.Panic != "boom" || f.e.Status != http.StatusInternalServerError || !f.e.Aborted {
+		t.Fatal(f.e.Panic, f.e.Status)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	loghttp.GetFormatter(loghttp.LogFormatJson).FormatResponse(buf, &f.e)
+	if !strings.Contains(buf.String(), `"panic":"boom","aborted":true`) {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestAdminTokenAuth(t *testing.T) {
+	rt := loghttp.GetRuntime(loghttp.NewHttpLogger(xlog.GetLogger()))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rt.AdminRoutes(r.Group("/admin", gineve.AdminTokenAuth("secret")))
+
+	get := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/loghttp", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get("", ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	}
+	if code := get("Authorization", "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	}
+	if code := get("Authorization", "Bearer secret"); code != http.StatusOK {
+		t.Fatal(code)
+	}
+	if code := get(gineve.AdminTokenHeader, "secret"); code != http.StatusOK {
+		t.Fatal(code)
+	}
+}
+
+func TestRuntime(t *testing.T) {
+	f := &recordFormatter{}
+	// 直接触发ttl到期的恢复，不依赖时间
+	var revert func()
+	rt := loghttp.NewRuntime(loghttp.OptRuntimeAfterFunc(func(d time.Duration, f func()) {
+		revert = f
+	}))
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(f), loghttp.OptLogRuntime(rt))
+	if loghttp.GetRuntime(logger) != rt {
+		t.Fatal("runtime not match")
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rt.AdminRoutes(r.Group("/admin"))
+	r.POST("/echo", logger.LogHttp(), func(ctx *gin.Context) {
+		d, _ := ctx.GetRawData()
+		ctx.Writer.Write(d)
+	})
+	post := func(target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/loghttp?ttl=5m", strings.NewReader(`{"requestBody":false}`)))
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	post("/echo", "hello")
+	if f.e.RequestBody != nil {
+		t.Fatal("request body must not be logged")
+	}
+
+	if revert == nil {
+		t.Fatal("expect revert after ttl")
+	}
+	revert()
+	post("/echo", "hello")
+	if string(f.e.RequestBody) != "hello" {
+		t.Fatal("runtime setting must be reverted")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/loghttp", strings.NewReader(`{"level":"verbose"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestHar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loghttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 已存在的HAR文件不会被清空
+	if err := ioutil.WriteFile(filepath.Join(dir, "traffic.har"), []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := loghttp.NewHarFileRecorder(filepath.Join(dir, "traffic.har"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := loghttp.NewHarRing(1)
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(&recordFormatter{}),
+		loghttp.OptLogRecorder(file), loghttp.OptLogRecorder(ring))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logger.LogHttp())
+	r.POST("/echo", func(ctx *gin.Context) {
+		d, _ := ctx.GetRawData()
+		ctx.Data(http.StatusOK, "application/json", d)
+	})
+	ring.AdminRoutes(r.Group("/admin"))
+
+	for _, body := range []string{`{"password":"p1"}`, `{"name":"n2"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/echo?a=1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer x")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var har struct {
+		Log loghttp.HarLog `json:"log"`
+	}
+	d, err := ioutil.ReadFile(filepath.Join(dir, "traffic.har"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(d, &har); err != nil {
+		t.Fatal(err, string(d))
+	}
+	if len(har.Log.Entries) != 2 || file.Stats().Written != 2 {
+		t.Fatal(string(d))
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "traffic-*.har")); len(matches) != 1 {
+		t.Fatal(matches)
+	} else if d, _ := ioutil.ReadFile(matches[0]); string(d) != "previous" {
+		t.Fatal(string(d))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.URL != "http://example.com/echo?a=1" || entry.Request.PostData.Text != `{"password":"p1"}` ||
+		entry.Response.Content.Text != `{"password":"p1"}` || entry.Response.Status != http.StatusOK {
+		t.Fatal(string(d))
+	}
+	for _, h := range entry.Request.Headers {
+		if h.Name == "Authorization" && h.Value != loghttp.DefaultRedactMask {
+			t.Fatal(h)
+		}
+	}
+
+	// 只保留最近的1条
+	w := serve(r, "/admin/loghttp/har")
+	har.Log.Entries = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &har); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	if len(har.Log.Entries) != 1 || har.Log.Entries[0].Request.PostData.Text != `{"name":"n2"}` {
+		t.Fatal(w.Body.String())
+	}
+
+	// 超过大小时切割，每个文件都是完整的HAR
+	rotateDir := filepath.Join(dir, "rotate")
+	file, err = loghttp.NewHarFileRecorder(filepath.Join(rotateDir, "traffic.har"),
+		loghttp.OptHarMaxSize(1500), loghttp.OptHarMaxBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(&recordFormatter{}), loghttp.OptLogRecorder(file))
+	r = gin.New()
+	r.GET("/ping", logger.LogHttp(), func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "pong")
+	})
+	for i := 0; i < 10; i++ {
+		serve(r, "/ping")
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	infos, _ := ioutil.ReadDir(rotateDir)
+	if len(infos) != 3 {
+		t.Fatalf("expect 1 file and 2 backups but get %d", len(infos))
+	}
+	for _, info := range infos {
+		d, _ := ioutil.ReadFile(filepath.Join(rotateDir, info.Name()))
+		har.Log.Entries = nil
+		if err := json.Unmarshal(d, &har); err != nil || len(har.Log.Entries) == 0 || info.Size() > 1500 {
+			t.Fatal(err, info.Name(), string(d))
+		}
+	}
+}
+
+func TestInspector(t *testing.T) {
+	inspector := loghttp.NewInspector(2, 4)
+	logger := loghttp.NewHttpLogger(xlog.GetLogger(), loghttp.OptLogFormatter(&recordFormatter{}), loghttp.OptLogRecorder(inspector))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logger.LogHttp())
+	r.GET("/users/:id", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "user-"+ctx.Param("id"))
+	})
+	admin := gin.New()
+	inspector.AdminRoutes(admin.Group("/admin"))
+
+	serve(r, "/users/1")
+	serve(r, "/users/2")
+	serve(r, "/none")
+
+	list := inspector.Find(loghttp.InspectorFilter{})
+	if len(list) != 2 || list[0].Path != "/none" || list[1].Path != "/users/2" {
+		t.Fatal(list)
+	}
+	if string(list[1].ResponseBody) != "user" || !list[1].ResponseBodyTruncated {
+		t.Fatal(string(list[1].ResponseBody))
+	}
+	list = inspector.Find(loghttp.InspectorFilter{Path: "/users/:id", Status: "2xx"})
+	if len(list) != 1 || list[0].Status != http.StatusOK {
+		t.Fatal(list)
+	}
+
+	w := serve(admin, "/admin/loghttp/inspector?status=404")
+	var ret struct {
+		Data []struct {
+			Path   string `json:"path"`
+			Status int    `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil || len(ret.Data) != 1 || ret.Data[0].Path != "/none" {
+		t.Fatal(err, w.Body.String())
+	}
+	w = serve(admin, "/admin/loghttp/inspector?status=abc")
+	if w.Code != http.StatusBadRequest {
+		t.Fatal(w.Code)
+	}
+	w = serve(admin, "/admin/loghttp/inspector/view?path=/users")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/users/2") || strings.Contains(w.Body.String(), "/none") {
+		t.Fatal(w.Body.String())
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-web/gineve"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newQueryContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return ctx, w
+}
+
+func TestParseQuery(t *testing.T) {
+	ctx, w := newQueryContext("/items?page=2&size=10&sort=-createdAt,name&filter[status]=x")
+	q, err := gineve.ParseQuery(ctx, gineve.OptQuerySortFields("createdAt", "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 2 || q.Size != 10 || q.Offset() != 10 || q.Filter["status"] != "x" {
+		t.Fatal(q)
+	}
+	if len(q.Sort) != 2 || q.Sort[0].Field != "createdAt" || !q.Sort[0].Desc || q.Sort[1].Desc {
+		t.Fatal(q.Sort)
+	}
+
+	gineve.WritePageHeaders(ctx, q, 35)
+	if w.Header().Get(gineve.HeaderTotalCount) != "35" {
+		t.Fatal(w.Header())
+	}
+	link := w.Header().Get(gineve.HeaderLink)
+	if !strings.Contains(link, `rel="prev"`) || !strings.Contains(link, `rel="next"`) || !strings.Contains(link, "page=4") {
+		t.Fatal(link)
+	}
+	if q.PageInfo(35).Pages != 4 {
+		t.Fatal(q.PageInfo(35))
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	targets := []string{
+		"/items?page=0",
+		"/items?size=abc",
+		"/items?size=100000",
+		"/items?sort=password",
+	}
+	for _, target := range targets {
+		ctx, _ := newQueryContext(target)
+		_, err := gineve.NewQueryParser(gineve.OptQuerySortFields("name")).Parse(ctx)
+		if err == nil {
+			t.Fatalf("%s expect error", target)
+		}
+		t.Log(err)
+	}
+}
+
+func TestQueryConfig(t *testing.T) {
+	parse := func(config, target string) (*gineve.Query, error) {
+		conf, err := fig.LoadYamlFile(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := gineve.NewQueryParserFromConfig(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 与Processor一致，通过请求设置QueryParser
+		ctx, _ := newQueryContext(target)
+		gineve.QueryParserHandler(p)(ctx)
+		return gineve.ParseQuery(ctx)
+	}
+
+	// 未配置maxSize时使用DefaultMaxPageSize
+	if _, err := parse("assets/config-test.yaml", "/items?size=1000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parse("assets/config-test.yaml", "/items?size=1001"); err == nil {
+		t.Fatal("expect size exceeds the default maximum")
+	}
+
+	q, err := parse("assets/config-query.yaml", "/items")
+	if err != nil || q.Size != 10 {
+		t.Fatal(err, q)
+	}
+	if _, err := parse("assets/config-query.yaml", "/items?size=51"); err == nil {
+		t.Fatal("expect size exceeds the maximum")
+	}
+
+	conf, err := fig.LoadYamlFile("assets/config-query-invalid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gineve.NewQueryParserFromConfig(conf); err == nil {
+		t.Fatal("expect defaultSize exceeds maxSize error")
+	}
+}
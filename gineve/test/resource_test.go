@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/gineve"
+	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type book struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type bookResource struct {
+	books map[string]*book
+}
+
+func (r *bookResource) ResourceName() string {
+	return "books"
+}
+
+func (r *bookResource) NewResource() interface{} {
+	return &book{}
+}
+
+func (r *bookResource) List(ctx *gin.Context, query *gineve.Query) (interface{}, int64, error) {
+	ids := make([]string, 0, len(r.books))
+	for id := range r.books {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ret := []*book{}
+	for i := query.Offset(); i < len(ids) && len(ret) < query.Size; i++ {
+		ret = append(ret, r.books[ids[i]])
+	}
+	return ret, int64(len(ids)), nil
+}
+
+func (r *bookResource) Get(ctx *gin.Context, id string) (interface{}, error) {
+	// 不存在时返回类型化的nil指针
+	return r.books[id], nil
+}
+
+func (r *bookResource) Create(ctx *gin.Context, obj interface{}) (interface{}, error) {
+	b := obj.(*book)
+	if _, ok := r.books[b.Id]; ok {
+		return nil, fmt.Errorf("create book %s: %w", b.Id, gineve.ErrConflict)
+	}
+	r.books[b.Id] = b
+	return b, nil
+}
+
+func (r *bookResource) Update(ctx *gin.Context, id string, obj interface{}) (interface{}, error) {
+	if _, ok := r.books[id]; !ok {
+		return nil, gineve.ErrNotFound
+	}
+	b := obj.(*book)
+	b.Id = id
+	r.books[id] = b
+	return b, nil
+}
+
+func (r *bookResource) Patch(ctx *gin.Context, id string, patch map[string]interface{}) (interface{}, error) {
+	b, ok := r.books[id]
+	if !ok {
+		return nil, gineve.ErrNotFound
+	}
+	if v, ok := patch["title"].(string); ok {
+		b.Title = v
+	}
+	return b, nil
+}
+
+func (r *bookResource) Delete(ctx *gin.Context, id string) error {
+	if _, ok := r.books[id]; !ok {
+		return gineve.ErrNotFound
+	}
+	delete(r.books, id)
+	return nil
+}
+
+func TestResource(t *testing.T) {
+	res := &bookResource{books: map[string]*book{}}
+	for i := 1; i <= 3; i++ {
+		id := strconv.Itoa(i)
+		res.books[id] = &book{Id: id, Title: "book" + id}
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := ""
+	r.Use(func(ctx *gin.Context) {
+		ctx.Next()
+		handler = ctx.GetString(loghttp.HandlerKey)
+	})
+	gineve.NewResourceComponent(res).HttpRoutes(r)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/books?page=2&size=1", "")
+	if handler != "*test.bookResource.List" {
+		t.Fatal(handler)
+	}
+	if w.Code != http.StatusOK ||
+		w.Body.String() != `{"code":0,"message":"ok","data":[{"id":"2","title":"book2"}],"page":{"page":2,"size":1,"total":3,"pages":3}}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	if w.Header().Get(gineve.HeaderTotalCount) != "3" {
+		t.Fatal(w.Header())
+	}
+	link := w.Header().Get(gineve.HeaderLink)
+	if !strings.Contains(link, `</books?page=1&size=1>; rel="prev"`) || !strings.Contains(link, `</books?page=3&size=1>; rel="last"`) {
+		t.Fatal(link)
+	}
+
+	w = do(http.MethodGet, "/books/1", "")
+	if w.Code != http.StatusOK || w.Body.String() != `{"code":0,"message":"ok","data":{"id":"1","title":"book1"}}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/books/9", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPost, "/books", `{"id":"4","title":"book4"}`)
+	if w.Code != http.StatusCreated || res.books["4"] == nil {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, "/books", `{"id":"4","title":"again"}`)
+	if w.Code != http.StatusConflict || res.books["4"].Title != "book4" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPut, "/books/1", `{"title":"new"}`)
+	if w.Code != http.StatusOK || w.Body.String() != `{"code":0,"message":"ok","data":{"id":"1","title":"new"}}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = do(http.MethodPut, "/books/9", `{"title":"new"}`)
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPatch, "/books/2", `{"title":"patched"}`)
+	if w.Code != http.StatusOK || res.books["2"].Title != "patched" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = do(http.MethodPatch, "/books/9", `{"title":"patched"}`)
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodDelete, "/books/3", "")
+	if w.Code != http.StatusOK || res.books["3"] != nil {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	w = do(http.MethodDelete, "/books/3", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
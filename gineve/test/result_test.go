@@ -0,0 +1,333 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-web/gineve"
+	"github.com/xfali/neve-web/gineve/midware/fieldset"
+	"github.com/xfali/neve-web/gineve/midware/jsonpolicy"
+	"github.com/xfali/neve-web/gineve/midware/metrics"
+	"github.com/xfali/neve-web/gineve/midware/requestid"
+	"github.com/xfali/neve-web/mask"
+	"github.com/xfali/neve-web/result"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type owner struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type project struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+	Owner  owner  `json:"owner"`
+}
+
+func serve(r *gin.Engine, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/projects", fieldset.Fields("id", "name", "owner"), func(ctx *gin.Context) {
+		ret := result.Ok([]project{{Id: 1, Name: "neve", Secret: "s", Owner: owner{Name: "x", Email: "x@neve.com"}}})
+		ret.WriteJson(ctx)
+	})
+
+	w := serve(r, "/projects?fields=id,owner.email")
+	if w.Body.String() != `{"code":0,"message":"ok","data":[{"id":1,"owner":{"email":"x@neve.com"}}]}` {
+		t.Fatal(w.Body.String())
+	}
+
+	w = serve(r, "/projects?fields=id,secret")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 but get %d", w.Code)
+	}
+	// 裁剪失败时不输出未裁剪的数据
+	r.GET("/broken", fieldset.Fields(), func(ctx *gin.Context) {
+		ret := result.Ok(brokenJson{Secret: "s"})
+		ret.WriteJson(ctx)
+	})
+	w = serve(r, "/broken?fields=id")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+type brokenJson struct {
+	Secret string `json:"secret"`
+}
+
+func (brokenJson) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("broken")
+}
+
+type member struct {
+	Name   string   `json:"name" mask:"name"`
+	Phone  string   `json:"phone" mask:"phone"`
+	Email  *string  `json:"email" mask:"email"`
+	IdCard string   `json:"idCard" mask:"idcard"`
+	Cards  []string `json:"cards" mask:"tail"`
+}
+
+type Contact struct {
+	Mobile string `json:"mobile" mask:"phone"`
+}
+
+type staff struct {
+	Id int `json:"id"`
+	Contact
+}
+
+type chain struct {
+	Phone string `json:"phone" mask:"phone"`
+	Next  *chain `json:"next,omitempty"`
+}
+
+func TestMask(t *testing.T) {
+	mask.Register("tail", mask.Keep(0, 2))
+	email := "neve@neve.com"
+	m := &member{Name: "张三丰", Phone: "13812345678", Email: &email, IdCard: "110101199001011234", Cards: []string{"6222"}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/member", func(ctx *gin.Context) {
+		if ctx.Query("privileged") != "" {
+			result.SkipMask(ctx)
+		}
+		ret := result.Ok([]interface{}{m})
+		ret.WriteJson(ctx)
+	})
+
+	w := serve(r, "/member")
+	expect := `{"code":0,"message":"ok","data":[{"name":"张**","phone":"138****5678","email":"n***@neve.com","idCard":"1101**********1234","cards":["**22"]}]}`
+	if w.Body.String() != expect {
+		t.Fatal(w.Body.String())
+	}
+	if m.Phone != "13812345678" || *m.Email != email {
+		t.Fatal("origin data must not be modified")
+	}
+
+	w = serve(r, "/member?privileged=true")
+	if w.Body.String() == expect {
+		t.Fatal(w.Body.String())
+	}
+
+	// 导出的内嵌struct提升的字段
+	s := staff{Id: 1, Contact: Contact{Mobile: "13812345678"}}
+	r.GET("/staff", func(ctx *gin.Context) {
+		ret := result.Ok(s)
+		ret.WriteJson(ctx)
+	})
+	w = serve(r, "/staff")
+	if w.Body.String() != `{"code":0,"message":"ok","data":{"id":1,"mobile":"138****5678"}}` {
+		t.Fatal(w.Body.String())
+	}
+	if s.Mobile != "13812345678" {
+		t.Fatal("origin data must not be modified")
+	}
+	// 超过最大深度的部分不会输出未脱敏的数据
+	var head *chain
+	for i := 0; i < 40; i++ {
+		head = &chain{Phone: "13812345678", Next: head}
+	}
+	b, err := json.Marshal(mask.Mask(head))
+	if err != nil || strings.Contains(string(b), "13812345678") || !strings.Contains(string(b), "138****5678") {
+		t.Fatal(err, string(b))
+	}
+}
+
+type order struct {
+	Id      int64     `json:"id"`
+	Count   int       `json:"count"`
+	Remark  string    `json:"remark"`
+	Tags    []string  `json:"tags"`
+	Created time.Time `json:"created"`
+}
+
+func TestJsonPolicy(t *testing.T) {
+	enc := result.NewJsonEncoder(result.JsonPolicy{
+		Int64AsString: true,
+		EscapeHTML:    false,
+	})
+	o := order{
+		Id:      1234567890123456789,
+		Count:   1,
+		Remark:  "<b>",
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	expect := `{"id":"1234567890123456789","count":1,"remark":"<b>","tags":null,"created":"2024-01-02T03:04:05Z"}`
+	b, err := enc.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expect {
+		t.Fatal(string(b))
+	}
+
+	// ctx.JSON重新编码的输出与WriteJson一致
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(jsonpolicy.Reencode(enc))
+	r.GET("/order", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, o)
+	})
+	w := serve(r, "/order")
+	if w.Body.String() != expect {
+		t.Fatal(w.Body.String())
+	}
+
+	// 默认使用encoding/json
+	b, err = result.GetJsonEncoder().Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std, _ := json.Marshal(o)
+	if string(b) != string(std) {
+		t.Fatal(string(b))
+	}
+
+	// 无法对ctx.JSON生效的配置启动失败
+	conf, err := fig.LoadYamlFile("assets/config-json-invalid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gineve.NewProcessor().Init(conf, nil); err == nil {
+		t.Fatal("expect unsupported json config error")
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	u := &requestid.RequestIdUtil{Generator: requestid.ULID}
+	r.Use(u.RequestId(), result.EnableRequestId)
+	r.GET("/id", func(ctx *gin.Context) {
+		if requestid.FromContext(ctx.Request.Context()) != requestid.Get(ctx) {
+			t.Fatal("request id not match")
+		}
+		ret := result.Ok(nil)
+		ret.WriteJson(ctx)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set(requestid.DefaultHeader, "abc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Header().Get(requestid.DefaultHeader) != "abc" || w.Body.String() != `{"code":0,"message":"ok","requestId":"abc"}` {
+		t.Fatal(w.Header(), w.Body.String())
+	}
+
+	w = serve(r, "/id")
+	if len(w.Header().Get(requestid.DefaultHeader)) != 26 {
+		t.Fatal(w.Header())
+	}
+
+	// 默认不输出requestId字段；未使用RequestId中间件时GetOrCreate使用请求中设置的Generator
+	r = gin.New()
+	r.Use(requestid.GeneratorHandler(requestid.ULID))
+	r.GET("/id", func(ctx *gin.Context) {
+		if id := requestid.GetOrCreate(ctx); len(id) != 26 {
+			t.Fatal(id)
+		}
+		ret := result.Ok(nil)
+		ret.WriteJson(ctx)
+	})
+	w = serve(r, "/id")
+	if w.Body.String() != `{"code":0,"message":"ok"}` {
+		t.Fatal(w.Body.String())
+	}
+	if _, err := requestid.GetGenerator("uid"); err == nil {
+		t.Fatal("expect unknown generator error")
+	}
+	conf, err := fig.LoadYamlFile("assets/config-requestid-invalid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 配置错误时Init返回错误，不会使用容器
+	if err := gineve.NewProcessor().Init(conf, nil); err == nil {
+		t.Fatal("expect unknown generator error")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.NewMetrics(metrics.OptBuckets(0.1, 1), metrics.OptSizeBuckets(10))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// recovery写出的状态码不影响指标
+	r.Use(func(ctx *gin.Context) {
+		defer func() {
+			if recover() != nil {
+				ctx.AbortWithStatus(http.StatusServiceUnavailable)
+			}
+		}()
+		ctx.Next()
+	}, m.Collect())
+	r.GET("/users/:id", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "user")
+	})
+	r.GET("/panic", func(ctx *gin.Context) {
+		panic("panic")
+	})
+	r.Handle("PURGE", "/users/:id", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	r.GET(m.Path(), m.Handler())
+
+	serve(r, "/users/1")
+	serve(r, "/users/2")
+	serve(r, "/none")
+	serve(r, "/panic")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PURGE", "/users/1", nil))
+
+	w = serve(r, "/metrics")
+	if w.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatal(w.Header())
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		`http_requests_total{method="GET",route="/panic",status="5xx"} 1`,
+		`http_requests_total{method="other",route="/users/:id",status="2xx"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="0.1"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id",status="2xx"} 2`,
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="10"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 8`,
+		`# TYPE http_requests_in_flight gauge`,
+		`http_requests_in_flight 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatal(line, "\n", body)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mask
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	TagName = "mask"
+
+	Phone    = "phone"
+	Email    = "email"
+	IdCard   = "idcard"
+	BankCard = "bankcard"
+	Name     = "name"
+	All      = "all"
+
+	maxDepth = 32
+)
+
+type Masker func(s string) string
+
+var (
+	lock     sync.RWMutex
+	registry = map[string]Masker{
+		Phone:    Keep(3, 4),
+		Email:    email,
+		IdCard:   Keep(4, 4),
+		BankCard: Keep(0, 4),
+		Name:     Keep(1, 0),
+		All:      Keep(0, 0),
+	}
+
+	typeCache sync.Map
+)
+
+// 注册自定义的Masker，同名覆盖
+func Register(name string, m Masker) {
+	lock.Lock()
+	defer lock.Unlock()
+	registry[name] = m
+}
+
+func Get(name string) (Masker, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	m, ok := registry[name]
+	return m, ok
+}
+
+// 使用名称为name的Masker处理s，未注册时返回s
+func String(name, s string) string {
+	if m, ok := Get(name); ok {
+		return m(s)
+	}
+	return s
+}
+
+// 保留前head个以及后tail个字符，其余替换为'*'；长度不足时全部替换
+func Keep(head, tail int) Masker {
+	return func(s string) string {
+		rs := []rune(s)
+		if len(rs) <= head+tail {
+			return strings.Repeat("*", len(rs))
+		}
+		for i := head; i < len(rs)-tail; i++ {
+			rs[i] = '*'
+		}
+		return string(rs)
+	}
+}
+
+func email(s string) string {
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		return Keep(1, 0)(s)
+	}
+	return Keep(1, 0)(s[:i]) + s[i:]
+}
+
+// 返回v的拷贝，其中带有mask tag的字符串字段（string、*string、[]string）按tag对应的Masker处理，
+// 如`mask:"phone"`。v本身不会被修改；不包含mask tag的类型直接返回v。
+// 仅处理导出的字段（包括导出的内嵌struct提升的字段），不支持未导出的内嵌struct，其中的mask tag不生效；
+// 嵌套超过maxDepth层的值输出为零值，不会输出未脱敏的数据。
+func Mask(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if !needMask(rv.Type()) {
+		return v
+	}
+	return copyValue(rv, 0).Interface()
+}
+
+func copyValue(v reflect.Value, depth int) reflect.Value {
+	if !needMask(v.Type()) {
+		return v
+	}
+	if depth > maxDepth {
+		return reflect.Zero(v.Type())
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.New(v.Type().Elem())
+		nv.Elem().Set(copyValue(v.Elem(), depth+1))
+		return nv
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.New(v.Type()).Elem()
+		nv.Set(copyValue(v.Elem(), depth+1))
+		return nv
+	case reflect.Struct:
+		nv := reflect.New(v.Type()).Elem()
+		nv.Set(v)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if name := field.Tag.Get(TagName); name != "" {
+				if m, ok := Get(name); ok {
+					maskField(nv.Field(i), m)
+					continue
+				}
+			}
+			nv.Field(i).Set(copyValue(v.Field(i), depth+1))
+		}
+		return nv
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			nv.Index(i).Set(copyValue(v.Index(i), depth+1))
+		}
+		return nv
+	case reflect.Array:
+		nv := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			nv.Index(i).Set(copyValue(v.Index(i), depth+1))
+		}
+		return nv
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		nv := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			nv.SetMapIndex(iter.Key(), copyValue(iter.Value(), depth+1))
+		}
+		return nv
+	}
+	return v
+}
+
+func maskField(v reflect.Value, m Masker) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(m(v.String()))
+	case reflect.Ptr:
+		if !v.IsNil() && v.Elem().Kind() == reflect.String {
+			s := reflect.New(v.Type().Elem())
+			s.Elem().SetString(m(v.Elem().String()))
+			v.Set(s)
+		}
+	case reflect.Slice:
+		if !v.IsNil() && v.Type().Elem().Kind() == reflect.String {
+			nv := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				nv.Index(i).SetString(m(v.Index(i).String()))
+			}
+			v.Set(nv)
+		}
+	}
+}
+
+// 判断类型中是否可能包含mask tag，interface需要根据实际的值判断
+func needMask(t reflect.Type) bool {
+	if v, ok := typeCache.Load(t); ok {
+		return v.(bool)
+	}
+	ret := checkType(t, map[reflect.Type]bool{})
+	typeCache.Store(t, ret)
+	return ret
+}
+
+func checkType(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkType(t.Elem(), visiting)
+	case reflect.Map:
+		return checkType(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Tag.Get(TagName) != "" || checkType(field.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -17,8 +17,12 @@
 package result
 
 var (
-	OK              = Result{Code: 0, Msg: "ok", HttpStatus: 200}
-	InternalError   = Result{Code: -1, Msg: "internal error", HttpStatus: 500}
-	ConnectError    = Result{Code: 1001, Msg: "connect error", HttpStatus: 500}
-	SettingNilError = Result{Code: 1002, Msg: "setting is nil", HttpStatus: 500}
+	OK                = Result{Code: 0, Msg: "ok", HttpStatus: 200}
+	InternalError     = Result{Code: -1, Msg: "internal error", HttpStatus: 500}
+	ConnectError      = Result{Code: 1001, Msg: "connect error", HttpStatus: 500}
+	SettingNilError   = Result{Code: 1002, Msg: "setting is nil", HttpStatus: 500}
+	BadRequestError   = Result{Code: 1003, Msg: "bad request", HttpStatus: 400}
+	NotFoundError     = Result{Code: 1004, Msg: "not found", HttpStatus: 404}
+	ConflictError     = Result{Code: 1005, Msg: "conflict", HttpStatus: 409}
+	UnauthorizedError = Result{Code: 1006, Msg: "unauthorized", HttpStatus: 401}
 )
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package result
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+const (
+	FieldsKey = "_NEVE_RESULT_FIELDS"
+)
+
+// 字段路径树，value为nil表示保留该字段的全部内容
+type fieldTree map[string]fieldTree
+
+// 解析逗号分隔的字段路径，如"id,name,owner.email"
+func ParseFields(s string) []string {
+	var ret []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f != "" {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// 设置当前请求输出的字段路径，WriteJson时会将Data裁剪为仅包含这些字段
+func SetFields(ctx *gin.Context, fields []string) {
+	ctx.Set(FieldsKey, fields)
+}
+
+func GetFields(ctx *gin.Context) []string {
+	if v, ok := ctx.Get(FieldsKey); ok {
+		if fields, ok := v.([]string); ok {
+			return fields
+		}
+	}
+	return nil
+}
+
+// 将data按json序列化后裁剪为仅包含fields中的字段路径，支持嵌套路径（如owner.email），
+// 数组中的每个元素均按相同的路径裁剪。
+func Project(data interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 || data == nil {
+		return data, nil
+	}
+	b, err := GetJsonEncoder().Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodeTree(b)
+	if err != nil {
+		return nil, err
+	}
+	return project(v, buildFieldTree(fields)), nil
+}
+
+func buildFieldTree(fields []string) fieldTree {
+	root := fieldTree{}
+	for _, f := range fields {
+		node := root
+		keys := strings.Split(f, ".")
+		for i, k := range keys {
+			sub, ok := node[k]
+			if ok && sub == nil {
+				// 已保留全部内容
+				break
+			}
+			if i == len(keys)-1 {
+				node[k] = nil
+				break
+			}
+			if !ok {
+				sub = fieldTree{}
+				node[k] = sub
+			}
+			node = sub
+		}
+	}
+	return root
+}
+
+func project(v interface{}, tree fieldTree) interface{} {
+	switch o := v.(type) {
+	case jsonObject:
+		ret := make(jsonObject, 0, len(tree))
+		for _, f := range o {
+			sub, ok := tree[f.key]
+			if !ok {
+				continue
+			}
+			if sub != nil {
+				f.value = project(f.value, sub)
+			}
+			ret = append(ret, f)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(o))
+		for i := range o {
+			ret[i] = project(o[i], tree)
+		}
+		return ret
+	default:
+		return v
+	}
+}
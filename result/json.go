@@ -0,0 +1,256 @@
+/*
+ * Copyright (C) 2019-2024, Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package result
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	JsonEncodedKey = "_NEVE_RESULT_JSON_ENCODED"
+
+	// javascript能够精确表示的最大整数
+	maxSafeInteger = 1<<53 - 1
+)
+
+var (
+	// 默认策略与encoding/json（gin）的输出一致，直接使用encoding/json
+	jsonEncoder JsonEncoder = stdJsonEncoder{}
+)
+
+// json编码策略，基于encoding/json实现，对Result.WriteJson以及ctx.JSON（重新编码）的输出一致。
+// 字段、time.Time等的输出格式与encoding/json相同，需要定制时由类型实现json.Marshaler。
+type JsonPolicy struct {
+	// 超出javascript安全范围（±2^53-1）的整数输出为字符串，避免javascript丢失精度
+	Int64AsString bool
+	// 是否转义HTML字符（<、>、&）
+	EscapeHTML bool
+}
+
+func DefaultJsonPolicy() JsonPolicy {
+	return JsonPolicy{
+		EscapeHTML: true,
+	}
+}
+
+type JsonEncoder interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// JsonEncoder可选实现，用于将已经编码的json（如gin ctx.JSON的输出）按编码策略重新编码
+type JsonReencoder interface {
+	Reencode(data []byte) ([]byte, error)
+}
+
+// 设置全局的JsonEncoder，Result.WriteJson使用该encoder输出
+func SetJsonEncoder(enc JsonEncoder) {
+	if enc != nil {
+		jsonEncoder = enc
+	}
+}
+
+func GetJsonEncoder() JsonEncoder {
+	return jsonEncoder
+}
+
+type stdJsonEncoder struct{}
+
+func (stdJsonEncoder) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+type policyEncoder struct {
+	policy JsonPolicy
+}
+
+// 创建按照policy编码的JsonEncoder，同时实现了JsonReencoder。
+// Marshal使用encoding/json编码后再按策略处理，与Reencode的结果一致。
+func NewJsonEncoder(policy JsonPolicy) *policyEncoder {
+	return &policyEncoder{policy: policy}
+}
+
+func (e *policyEncoder) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(e.policy.EscapeHTML)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// 去掉Encode输出的换行
+	buf.Truncate(buf.Len() - 1)
+	if !e.policy.Int64AsString {
+		return buf.Bytes(), nil
+	}
+	return e.Reencode(buf.Bytes())
+}
+
+func (e *policyEncoder) Reencode(data []byte) ([]byte, error) {
+	tree, err := decodeTree(data)
+	if err != nil {
+		return nil, err
+	}
+	tree = e.transform(tree)
+	buf := bytes.NewBuffer(nil)
+	err = writeTree(buf, tree, e.policy.EscapeHTML)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *policyEncoder) transform(node interface{}) interface{} {
+	switch v := node.(type) {
+	case jsonObject:
+		for i := range v {
+			v[i].value = e.transform(v[i].value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = e.transform(v[i])
+		}
+	case json.Number:
+		if e.policy.Int64AsString && !strings.ContainsAny(string(v), ".eE") {
+			if i, err := v.Int64(); err != nil || i > maxSafeInteger || i < -maxSafeInteger {
+				return string(v)
+			}
+		}
+	}
+	return node
+}
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// 保持字段顺序的json对象
+type jsonObject []jsonField
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	err := writeTree(buf, o, true)
+	return buf.Bytes(), err
+}
+
+func writeTree(buf *bytes.Buffer, node interface{}, escapeHTML bool) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(escapeHTML)
+	return writeNode(buf, enc, node, escapeHTML)
+}
+
+func writeNode(buf *bytes.Buffer, enc *json.Encoder, node interface{}, escapeHTML bool) error {
+	switch v := node.(type) {
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, f := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeLeaf(buf, enc, f.key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeNode(buf, enc, f.value, escapeHTML); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeNode(buf, enc, v[i], escapeHTML); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case json.RawMessage:
+		if !escapeHTML {
+			return json.Compact(buf, v)
+		}
+		tmp := bytes.NewBuffer(nil)
+		if err := json.Compact(tmp, v); err != nil {
+			return err
+		}
+		json.HTMLEscape(buf, tmp.Bytes())
+	default:
+		return writeLeaf(buf, enc, v)
+	}
+	return nil
+}
+
+func writeLeaf(buf *bytes.Buffer, enc *json.Encoder, v interface{}) error {
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	// 去掉Encode输出的换行
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// 保持字段顺序解码json
+func decodeTree(data []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return decodeNode(d)
+}
+
+func decodeNode(d *json.Decoder) (interface{}, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		obj := jsonObject{}
+		for d.More() {
+			kt, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := kt.(string)
+			value, err := decodeNode(d)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{key: key, value: value})
+		}
+		_, err = d.Token()
+		return obj, err
+	case '[':
+		arr := []interface{}{}
+		for d.More() {
+			value, err := decodeNode(d)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = d.Token()
+		return arr, err
+	}
+	return nil, fmt.Errorf("result: unexpected json delim %s", delim)
+}
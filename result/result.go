@@ -19,6 +19,17 @@ package result
 import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-web/ctxkey"
+	"github.com/xfali/neve-web/mask"
+	"strconv"
+)
+
+const (
+	MaskSkipKey = "_NEVE_RESULT_MASK_SKIP"
+	// 当前请求输出的Result是否包含请求ID，参考EnableRequestId
+	RequestIdEnableKey = "_NEVE_RESULT_REQUEST_ID"
+
+	jsonContentType = "application/json; charset=utf-8"
 )
 
 type Result struct {
@@ -26,17 +37,88 @@ type Result struct {
 	Msg  string      `json:"message"`
 	Data interface{} `json:"data,omitempty"`
 
+	Page *Page `json:"page,omitempty"`
+
+	// 请求ID，为空时不输出；当前请求调用过EnableRequestId时WriteJson使用当前请求的ID
+	RequestId string `json:"requestId,omitempty"`
+
 	Err error `json:"error,omitempty"`
 
 	HttpStatus int `json:"-"`
 }
 
+// 用于编码输出，code使用json.Number避免被JsonPolicy.Int64AsString转换为字符串
+type resultJson struct {
+	Code      json.Number `json:"code"`
+	Msg       string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	Page      *Page       `json:"page,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+	Err       error       `json:"error,omitempty"`
+}
+
+// 分页信息
+type Page struct {
+	// 页码，从1开始
+	Page int `json:"page"`
+	Size int `json:"size"`
+	// 总数
+	Total int64 `json:"total"`
+	// 总页数
+	Pages int `json:"pages"`
+}
+
+func NewPage(page, size int, total int64) *Page {
+	ret := &Page{Page: page, Size: size, Total: total}
+	if size > 0 {
+		ret.Pages = int((total + int64(size) - 1) / int64(size))
+	}
+	return ret
+}
+
 func Ok(data interface{}) Result {
 	return Result{Code: OK.Code, Msg: OK.Msg, Data: data, HttpStatus: OK.HttpStatus}
 }
 
+func OkPage(data interface{}, page *Page) Result {
+	ret := Ok(data)
+	ret.Page = page
+	return ret
+}
+
+// 输出json，使用全局的JsonEncoder编码（参考SetJsonEncoder）：
+// Data中带有mask tag的字段将被脱敏（参考mask.Mask），当前请求调用过SkipMask时不做处理；
+// 如果当前请求设置了输出字段（参考SetFields），Data将被裁剪为仅包含这些字段，裁剪失败时输出InternalError，不会输出未裁剪的Data。
 func (result *Result) WriteJson(ctx *gin.Context) {
-	ctx.JSON(result.HttpStatus, *result)
+	ret := *result
+	if ret.RequestId == "" && requestIdEnabled(ctx) {
+		ret.RequestId = ctxkey.GetRequestId(ctx)
+	}
+	if !maskSkipped(ctx) {
+		ret.Data = mask.Mask(ret.Data)
+	}
+	if fields := GetFields(ctx); len(fields) > 0 {
+		data, err := Project(ret.Data, fields)
+		if err != nil {
+			_ = ctx.Error(err)
+			ret = Result{
+				Code:       InternalError.Code,
+				Msg:        InternalError.Msg,
+				RequestId:  ret.RequestId,
+				HttpStatus: InternalError.HttpStatus,
+			}
+		} else {
+			ret.Data = data
+		}
+	}
+	b, err := GetJsonEncoder().Marshal(ret.toJson())
+	if err != nil {
+		_ = ctx.Error(err)
+		ctx.JSON(ret.HttpStatus, ret)
+		return
+	}
+	ctx.Set(JsonEncodedKey, true)
+	ctx.Data(ret.HttpStatus, jsonContentType, b)
 }
 
 func (result *Result) SetCode(code int64) *Result {
@@ -54,6 +136,16 @@ func (result *Result) SetData(v interface{}) *Result {
 	return result
 }
 
+func (result *Result) SetPage(v *Page) *Result {
+	result.Page = v
+	return result
+}
+
+func (result *Result) SetRequestId(v string) *Result {
+	result.RequestId = v
+	return result
+}
+
 func (result *Result) SetError(v error) *Result {
 	result.Err = v
 	return result
@@ -64,6 +156,17 @@ func (result *Result) SetHttpStatus(v int) *Result {
 	return result
 }
 
+func (result *Result) toJson() *resultJson {
+	return &resultJson{
+		Code:      json.Number(strconv.FormatInt(result.Code, 10)),
+		Msg:       result.Msg,
+		Data:      result.Data,
+		Page:      result.Page,
+		RequestId: result.RequestId,
+		Err:       result.Err,
+	}
+}
+
 func (result *Result) Clone() *Result {
 	ret := *result
 	return &ret
@@ -74,6 +177,26 @@ func (result *Result) Error() string {
 }
 
 func (result *Result) String() string {
-	b, _ := json.Marshal(result)
+	ret := *result
+	ret.Data = mask.Mask(ret.Data)
+	b, _ := json.Marshal(ret)
 	return string(b)
 }
+
+// 当前请求的Result输出时不做脱敏处理，用于有权限查看原始数据的调用方
+func SkipMask(ctx *gin.Context) {
+	ctx.Set(MaskSkipKey, true)
+}
+
+func maskSkipped(ctx *gin.Context) bool {
+	return ctx.GetBool(MaskSkipKey)
+}
+
+// 当前请求的Result输出时包含请求ID（requestId字段），Processor按neve.web.requestId.response配置为所有请求设置
+func EnableRequestId(ctx *gin.Context) {
+	ctx.Set(RequestIdEnableKey, true)
+}
+
+func requestIdEnabled(ctx *gin.Context) bool {
+	return ctx.GetBool(RequestIdEnableKey)
+}